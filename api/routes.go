@@ -4,12 +4,17 @@ import (
 	"streaming/controllers"
 	"streaming/initializers"
 	"streaming/middleware"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func Register(config *initializers.Config, micro *fiber.App) {
 	micro.Route("/livekit", func(router fiber.Router) {
+		// LiveKit signs webhook payloads itself, so no CheckAuth here
+		router.Post("/webhook", func(c *fiber.Ctx) error {
+			return controllers.LivekitWebhook(c, config)
+		})
 		router.All("/*", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
 			return controllers.LivekitHandler(c, config)
 		})
@@ -30,9 +35,15 @@ func Register(config *initializers.Config, micro *fiber.App) {
 	})
 
 	micro.Route("/streaming", func(router fiber.Router) {
-		router.Post("/room/create", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+		router.Post("/room/create", middleware.CheckAuth(config.Auth.Uri), middleware.Idempotency(initializers.RedisClient, 24*time.Hour), func(c *fiber.Ctx) error {
 			return controllers.CreateTradingRoom(c, config)
 		})
+		router.Post("/room/schedule", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.ScheduleTradingRoom(c, config)
+		})
+		router.Post("/room/schedule/:roomId/cancel", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.CancelScheduledRoom(c, config)
+		})
 		router.Post("/room/entry", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
 			return controllers.EntryTradingRoom(c, config)
 		})
@@ -46,19 +57,101 @@ func Register(config *initializers.Config, micro *fiber.App) {
 			func(c *fiber.Ctx) error {
 				return controllers.GetAllTradingRooms(c, config)
 			})
-		router.Post("/room/join/:roomId",
-			// middleware.CheckAuth(config.Auth.Uri),
-			func(c *fiber.Ctx) error {
-				return controllers.JoinTradingRoom(c, config)
-			})
+		router.Post("/room/join/:roomId", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.JoinTradingRoom(c, config)
+		})
+		router.Post("/room/join/:roomId/guest", func(c *fiber.Ctx) error {
+			return controllers.JoinTradingRoomAsGuest(c, config)
+		})
 		router.Delete("/room/delete/:roomId", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
 			return controllers.DeleteTradingRoom(c, config)
 		})
+		router.Patch("/room/:roomId", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.UpdateTradingRoom(c, config)
+		})
+		router.Post("/room/:roomId/pin", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.PinProduct(c, config)
+		})
+		router.Delete("/room/:roomId/pin", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.UnpinProduct(c, config)
+		})
+		router.Delete("/room/:roomId/participants/:identity", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.KickParticipant(c, config)
+		})
+		router.Post("/room/:roomId/participants/:identity/mute", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.MuteParticipant(c, config)
+		})
+		router.Post("/room/:roomId/participants/:identity/ban", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.BanParticipant(c, config)
+		})
+		router.Delete("/room/:roomId/participants/:identity/ban", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.UnbanParticipant(c, config)
+		})
+		router.Get("/room/:roomId/bans", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.GetRoomBans(c, config)
+		})
+		router.Get("/room/:roomId/audit", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.GetRoomAuditLog(c, config)
+		})
+		router.Post("/room/:roomId/cohosts/accept", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.AcceptCoHostInvite(c, config)
+		})
+		router.Post("/room/:roomId/cohosts/:identity", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.InviteCoHost(c, config)
+		})
+		router.Delete("/room/:roomId/cohosts/:identity", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.RemoveCoHost(c, config)
+		})
+		router.Post("/room/:roomId/chat", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.SendChatMessage(c, config)
+		})
+		router.Get("/room/:roomId/chat", func(c *fiber.Ctx) error {
+			return controllers.GetChatHistory(c, config)
+		})
+		router.Get("/room/:roomId/chat/settings", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.GetChatSettings(c, config)
+		})
+		router.Patch("/room/:roomId/chat/settings", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.UpdateChatSettings(c, config)
+		})
+		router.Delete("/room/:roomId/chat/:messageId", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.DeleteChatMessage(c, config)
+		})
+		router.Post("/room/:roomId/ingress", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.CreateRoomIngress(c, config)
+		})
+		router.Get("/room/:roomId/ingress", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.GetRoomIngress(c, config)
+		})
+		router.Post("/room/:roomId/ingress/rotate", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.RotateRoomIngress(c, config)
+		})
+		router.Post("/room/:roomId/recording/start", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.StartRecording(c, config)
+		})
+		router.Post("/room/:roomId/recording/stop", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.StopRecording(c, config)
+		})
+		router.Post("/room/:roomId/heartbeat", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.RoomHeartbeat(c, config)
+		})
 		router.Post("/checkTokenExp", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
 			return controllers.RefreshToken(c, config)
 		})
 		router.Get("/rooms/get", func(c *fiber.Ctx) error {
 			return controllers.GetRooms(c, config)
 		})
+		router.Get("/rooms/history", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.GetRoomHistory(c, config)
+		})
+		router.Get("/recordings", middleware.CheckAuth(config.Auth.Uri), func(c *fiber.Ctx) error {
+			return controllers.GetRecordings(c, config)
+		})
+		router.Get("/rooms/search", func(c *fiber.Ctx) error {
+			return controllers.SearchTradingRooms(c, config)
+		})
+		router.Get("/r/:slug", func(c *fiber.Ctx) error {
+			return controllers.ResolveRoomSlug(c, config)
+		})
 	})
 }
@@ -0,0 +1,230 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Defaults used when the backend section of config.yaml leaves them out
+const (
+	DefaultTimeout = 10 * time.Second
+	DefaultRetries = 2
+	retryBaseDelay = 100 * time.Millisecond
+)
+
+// Streaming is the record the backend keeps for every live room
+type Streaming struct {
+	Title     string    `json:"title"`
+	RoomID    string    `json:"roomId"`
+	UserID    string    `json:"userId"`
+	CreatedAt time.Time `json:"time"`
+}
+
+type Meta struct {
+	Limit int `json:"limit"`
+	Total int `json:"total"`
+}
+
+// StreamingPage is a page of /profiles/streaming
+type StreamingPage struct {
+	Data   []Streaming `json:"data"`
+	Meta   Meta        `json:"meta"`
+	Status string      `json:"status"`
+}
+
+// Client is the part of the backend API the streaming service uses
+type Client interface {
+	CreateStreaming(ctx context.Context, streaming Streaming) error
+	EndStreaming(ctx context.Context, roomId, userId string, endedAt time.Time) error
+	ListStreamings(ctx context.Context, query url.Values) (*StreamingPage, error)
+	FilterProductsByIds(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error)
+}
+
+// HTTPClient talks to the backend over HTTP
+type HTTPClient struct {
+	baseURL     string
+	productsURL string
+	// Subscription endpoint, see IsSubscriber
+	subscriptionsURL string
+	timeout          time.Duration
+	retries          int
+	http             *http.Client
+}
+
+func NewHTTPClient(baseURL string, timeout time.Duration, retries int) *HTTPClient {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if retries < 0 {
+		retries = DefaultRetries
+	}
+	return &HTTPClient{
+		baseURL:     baseURL,
+		productsURL: baseURL + "/blog/filterByIds",
+		timeout:     timeout,
+		retries:     retries,
+		http:        &http.Client{},
+	}
+}
+
+// WithSubscriptionsURL sets the endpoint IsSubscriber asks
+func (b *HTTPClient) WithSubscriptionsURL(subscriptionsURL string) *HTTPClient {
+	b.subscriptionsURL = subscriptionsURL
+	return b
+}
+
+// WithProductsURL points FilterProductsByIds to a catalog outside of the backend URI
+func (b *HTTPClient) WithProductsURL(productsURL string) *HTTPClient {
+	if productsURL != "" {
+		b.productsURL = productsURL
+	}
+	return b
+}
+
+func (b *HTTPClient) CreateStreaming(ctx context.Context, streaming Streaming) error {
+	// Not idempotent, a retry could register the stream twice
+	_, err := b.do(ctx, "create streaming", "POST", b.baseURL+"/profile/streaming", streaming, false)
+	return err
+}
+
+func (b *HTTPClient) EndStreaming(ctx context.Context, roomId, userId string, endedAt time.Time) error {
+	requestData := struct {
+		UserID    string    `json:"userID"`
+		DeletedAt time.Time `json:"time"`
+	}{UserID: userId, DeletedAt: endedAt}
+
+	_, err := b.do(ctx, "end streaming", "DELETE", b.baseURL+"/profile/streaming/"+url.PathEscape(roomId), requestData, true)
+	return err
+}
+
+func (b *HTTPClient) ListStreamings(ctx context.Context, query url.Values) (*StreamingPage, error) {
+	body, err := b.do(ctx, "list streamings", "GET", b.baseURL+"/profiles/streaming?"+query.Encode(), nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var page StreamingPage
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, &Error{Op: "list streamings", Err: fmt.Errorf("%w: failed to decode response: %v", ErrUnavailable, err)}
+	}
+	return &page, nil
+}
+
+func (b *HTTPClient) FilterProductsByIds(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error) {
+	requestPayload := struct {
+		IDs       []string `json:"ids"`
+		Publisher string   `json:"publisher"`
+	}{
+		IDs:       ids,
+		Publisher: publisherId,
+	}
+
+	// A POST, but only reads, so it is safe to repeat
+	body, err := b.do(ctx, "filter products", "POST", b.productsURL, requestPayload, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var backendResponse struct {
+		Blogs  json.RawMessage `json:"blogs"`
+		Status string          `json:"status"`
+	}
+	if err := json.Unmarshal(body, &backendResponse); err != nil {
+		return nil, &Error{Op: "filter products", Err: fmt.Errorf("%w: failed to decode response: %v", ErrUnavailable, err)}
+	}
+	return backendResponse.Blogs, nil
+}
+
+// IsSubscriber asks the subscriptions endpoint whether the user subscribed to the publisher.
+// The endpoint answers GET <url>?publisherId=<id>&userId=<id> with 200 {"subscribed": bool}.
+func (b *HTTPClient) IsSubscriber(ctx context.Context, publisherId, userId string) (bool, error) {
+	query := url.Values{"publisherId": {publisherId}, "userId": {userId}}
+	body, err := b.do(ctx, "check subscriber", "GET", b.subscriptionsURL+"?"+query.Encode(), nil, true)
+	if err != nil {
+		return false, err
+	}
+
+	var backendResponse struct {
+		Subscribed *bool `json:"subscribed"`
+	}
+	if err := json.Unmarshal(body, &backendResponse); err != nil || backendResponse.Subscribed == nil {
+		return false, &Error{Op: "check subscriber", Err: fmt.Errorf("%w: response has no subscribed field: %s", ErrUnavailable, body)}
+	}
+	return *backendResponse.Subscribed, nil
+}
+
+// do sends a JSON request and returns the response body, idempotent requests are retried
+func (b *HTTPClient) do(ctx context.Context, op, method, url string, payload interface{}, idempotent bool) ([]byte, error) {
+	var data []byte
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, &Error{Op: op, Err: fmt.Errorf("failed to marshal request: %w", err)}
+		}
+	}
+
+	attempts := 1
+	if idempotent {
+		attempts += b.retries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			// Exponential backoff with full jitter
+			delay := time.Duration(rand.Int63n(int64(retryBaseDelay << attempt)))
+			select {
+			case <-ctx.Done():
+				return nil, &Error{Op: op, Err: classify(ctx.Err())}
+			case <-time.After(delay):
+			}
+		}
+
+		var body []byte
+		body, err = b.attempt(ctx, method, url, data)
+		if err == nil {
+			return body, nil
+		}
+		if !retryable(err) {
+			break
+		}
+	}
+	return nil, &Error{Op: op, Err: err}
+}
+
+func (b *HTTPClient) attempt(ctx context.Context, method, url string, data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := b.http.Do(req)
+	if err != nil {
+		return nil, classify(err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, classify(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: res.StatusCode, Body: string(resBody)}
+	}
+	return resBody, nil
+}
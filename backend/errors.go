@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+var (
+	// ErrTimeout is returned when the backend did not answer before the deadline
+	ErrTimeout = errors.New("backend timed out")
+	// ErrUnavailable is returned when the backend could not be reached
+	ErrUnavailable = errors.New("backend unavailable")
+)
+
+// StatusError is returned when the backend answered with a non-2xx status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("backend request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Error wraps a failed backend call with the operation that failed
+type Error struct {
+	Op  string
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus maps a backend error to the status we answer our own clients with
+func HTTPStatus(err error) int {
+	if errors.Is(err, ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// IsNotFound reports whether the backend answered that the resource does not exist
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+// classify turns transport errors into ErrTimeout or ErrUnavailable
+func classify(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+// retryable reports whether a failed attempt may succeed when repeated
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable)
+}
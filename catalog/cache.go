@@ -0,0 +1,61 @@
+package catalog
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const cachePrefix = "products:"
+
+// CachedCatalog keeps fetched products in Redis, so re-opened rooms reuse them until the TTL passes
+type CachedCatalog struct {
+	next   ProductCatalog
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewCachedCatalog(next ProductCatalog, client *redis.Client, ttl time.Duration) *CachedCatalog {
+	return &CachedCatalog{next: next, client: client, ttl: ttl}
+}
+
+// cacheKey identifies the set of products of a publisher regardless of the ID order
+func cacheKey(ids []string, publisherId string) string {
+	sorted := append([]string(nil), ids...)
+	sort.Strings(sorted)
+	sum := sha1.Sum([]byte(strings.Join(sorted, "\x00")))
+	return cachePrefix + publisherId + ":" + hex.EncodeToString(sum[:])
+}
+
+func (cc *CachedCatalog) FetchProducts(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error) {
+	ids = uniqueIds(ids)
+	key := cacheKey(ids, publisherId)
+
+	if cached, err := cc.client.Get(ctx, key).Bytes(); err == nil {
+		return cached, nil
+	}
+	return cc.fetch(ctx, ids, key, publisherId)
+}
+
+func (cc *CachedCatalog) RefreshProducts(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error) {
+	ids = uniqueIds(ids)
+	return cc.fetch(ctx, ids, cacheKey(ids, publisherId), publisherId)
+}
+
+// fetch asks the wrapped catalog and caches its answer under key
+func (cc *CachedCatalog) fetch(ctx context.Context, ids []string, key, publisherId string) (json.RawMessage, error) {
+	products, err := cc.next.FetchProducts(ctx, ids, publisherId)
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed cache write only costs a refetch next time
+	cc.client.Set(ctx, key, []byte(products), cc.ttl)
+	return products, nil
+}
@@ -0,0 +1,72 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// pricedCatalog answers with the current price and counts its calls
+type pricedCatalog struct {
+	price int
+	calls int
+}
+
+func (p *pricedCatalog) FetchProducts(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error) {
+	p.calls++
+	return json.RawMessage(fmt.Sprintf(`[{"id":%q,"price":%d}]`, ids[0], p.price)), nil
+}
+
+func TestCachedCatalogRefresh(t *testing.T) {
+	mr := miniredis.RunT(t)
+	source := &pricedCatalog{price: 10}
+	cached := NewCachedCatalog(source, redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour)
+	ctx := context.Background()
+
+	steps := []struct {
+		name      string
+		price     int
+		fetch     func(ctx context.Context, catalog ProductCatalog, ids []string, publisherId string) (json.RawMessage, error)
+		want      string
+		wantCalls int
+	}{
+		{"first fetch", 10, fetchProducts, `[{"id":"gold","price":10}]`, 1},
+		{"cached", 20, fetchProducts, `[{"id":"gold","price":10}]`, 1},
+		{"fresh fetch after a price change", 20, FetchFreshProducts, `[{"id":"gold","price":20}]`, 2},
+		{"cache holds the fresh products", 30, fetchProducts, `[{"id":"gold","price":20}]`, 2},
+	}
+
+	for _, step := range steps {
+		source.price = step.price
+		products, err := step.fetch(ctx, cached, []string{"gold", "gold"}, "publisher")
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if string(products) != step.want {
+			t.Errorf("%s: products = %s, want %s", step.name, products, step.want)
+		}
+		if source.calls != step.wantCalls {
+			t.Errorf("%s: source called %d times, want %d", step.name, source.calls, step.wantCalls)
+		}
+	}
+}
+
+func TestFetchFreshProductsWithoutCache(t *testing.T) {
+	source := &pricedCatalog{price: 10}
+	products, err := FetchFreshProducts(context.Background(), source, []string{"gold"}, "publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(products) != `[{"id":"gold","price":10}]` || source.calls != 1 {
+		t.Errorf("products = %s after %d calls, want them from the source", products, source.calls)
+	}
+}
+
+func fetchProducts(ctx context.Context, catalog ProductCatalog, ids []string, publisherId string) (json.RawMessage, error) {
+	return catalog.FetchProducts(ctx, ids, publisherId)
+}
@@ -0,0 +1,55 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ProductCatalog resolves product IDs to the product details shown in a room
+type ProductCatalog interface {
+	// FetchProducts returns the requested products of the publisher as a JSON array
+	FetchProducts(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error)
+}
+
+// Refresher is implemented by catalogs which may answer from a cache
+type Refresher interface {
+	// RefreshProducts fetches the products from the source and replaces the cached ones
+	RefreshProducts(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error)
+}
+
+// FetchFreshProducts bypasses any cache of the catalog, for changes the publisher expects to see at once
+func FetchFreshProducts(ctx context.Context, catalog ProductCatalog, ids []string, publisherId string) (json.RawMessage, error) {
+	if refresher, ok := catalog.(Refresher); ok {
+		return refresher.RefreshProducts(ctx, ids, publisherId)
+	}
+	return catalog.FetchProducts(ctx, ids, publisherId)
+}
+
+// uniqueIds drops duplicated and empty IDs while keeping their order
+func uniqueIds(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// concatArrays merges several JSON arrays into one
+func concatArrays(arrays []json.RawMessage) (json.RawMessage, error) {
+	merged := []json.RawMessage{}
+	for _, array := range arrays {
+		if len(array) == 0 || string(array) == "null" {
+			continue
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(array, &items); err != nil {
+			return nil, err
+		}
+		merged = append(merged, items...)
+	}
+	return json.Marshal(merged)
+}
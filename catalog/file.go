@@ -0,0 +1,37 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FileCatalog serves products from a local fixture file, for development without the backend.
+// The file is a JSON object mapping product IDs to the product objects.
+type FileCatalog struct {
+	products map[string]json.RawMessage
+}
+
+func NewFileCatalog(path string) (*FileCatalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil, fmt.Errorf("failed to parse product fixtures %s: %w", path, err)
+	}
+	return &FileCatalog{products: products}, nil
+}
+
+func (f *FileCatalog) FetchProducts(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error) {
+	found := []json.RawMessage{}
+	for _, id := range uniqueIds(ids) {
+		if product, ok := f.products[id]; ok {
+			found = append(found, product)
+		}
+	}
+	return json.Marshal(found)
+}
@@ -0,0 +1,45 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"streaming/backend"
+)
+
+// Used when products.batch_size is not configured
+const DefaultBatchSize = 50
+
+// HTTPCatalog fetches products from the backend blog/filterByIds endpoint
+type HTTPCatalog struct {
+	client    backend.Client
+	batchSize int
+}
+
+func NewHTTPCatalog(client backend.Client, batchSize int) *HTTPCatalog {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &HTTPCatalog{client: client, batchSize: batchSize}
+}
+
+func (h *HTTPCatalog) FetchProducts(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error) {
+	ids = uniqueIds(ids)
+	if len(ids) <= h.batchSize {
+		return h.client.FilterProductsByIds(ctx, ids, publisherId)
+	}
+
+	// Large rooms are fetched in several requests so one call stays within backend limits
+	var batches []json.RawMessage
+	for start := 0; start < len(ids); start += h.batchSize {
+		end := start + h.batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		products, err := h.client.FilterProductsByIds(ctx, ids[start:end], publisherId)
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, products)
+	}
+	return concatArrays(batches)
+}
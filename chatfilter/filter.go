@@ -0,0 +1,59 @@
+package chatfilter
+
+import "context"
+
+// Message is a chat message submitted for review together with the rules of its room
+type Message struct {
+	RoomID string
+	UserID string
+	Text   string
+	Rules  Rules
+}
+
+// Rules are the per-room settings filters take into account
+type Rules struct {
+	// Words and phrases banned in this room, on top of the global ones
+	BannedWords []string
+	// Whether messages containing links are rejected
+	BlockLinks bool
+}
+
+// Verdict is the outcome of a review, Reason tells the sender why a message was rejected
+type Verdict struct {
+	Allowed bool
+	Reason  string
+}
+
+// Allow is the verdict of a message no filter objected to
+var Allow = Verdict{Allowed: true}
+
+// Reject returns the verdict of a rejected message
+func Reject(reason string) Verdict {
+	return Verdict{Reason: reason}
+}
+
+// Filter reviews chat messages before they are stored and relayed. Implementations may call
+// out to external classifiers, an error means the message could not be reviewed.
+type Filter interface {
+	Check(ctx context.Context, message Message) (Verdict, error)
+}
+
+// Func adapts a function to Filter, handy for in-process fakes
+type Func func(ctx context.Context, message Message) (Verdict, error)
+
+func (f Func) Check(ctx context.Context, message Message) (Verdict, error) {
+	return f(ctx, message)
+}
+
+// Chain runs filters in order, the first rejection or error wins
+type Chain []Filter
+
+func (c Chain) Check(ctx context.Context, message Message) (Verdict, error) {
+	for _, filter := range c {
+		verdict, err := filter.Check(ctx, message)
+		if err != nil || !verdict.Allowed {
+			return verdict, err
+		}
+	}
+	return Allow, nil
+}
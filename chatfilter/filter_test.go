@@ -0,0 +1,114 @@
+package chatfilter
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWordFilter(t *testing.T) {
+	filter := NewWordFilter([]string{"scam", "pump and dump", " "})
+	tests := []struct {
+		name        string
+		text        string
+		roomBanned  []string
+		wantAllowed bool
+	}{
+		{"clean message", "Gold looks strong today", nil, true},
+		{"global word", "this is a scam", nil, false},
+		{"case and punctuation", "SCAM!!!", nil, false},
+		{"fullwidth letters", "ｓｃａｍ", nil, false},
+		{"word inside another word", "scampi for dinner", nil, true},
+		{"global phrase", "classic Pump and   Dump", nil, false},
+		{"phrase words apart", "pump the price and dump it", nil, true},
+		{"room word", "buy my course", []string{"course"}, false},
+		{"room word with diacritics", "cafe", []string{"café"}, false},
+		{"cyrillic room word", "Это Развод", []string{"развод"}, false},
+		{"room word of another room", "buy my course", []string{"signals"}, true},
+		{"empty room entry", "anything", []string{"", "  "}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := filter.Check(context.Background(), Message{Text: tt.text, Rules: Rules{BannedWords: tt.roomBanned}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verdict.Allowed != tt.wantAllowed {
+				t.Errorf("Check(%q) allowed = %t, want %t", tt.text, verdict.Allowed, tt.wantAllowed)
+			}
+			if !verdict.Allowed && verdict.Reason == "" {
+				t.Error("rejection without a reason")
+			}
+		})
+	}
+}
+
+func TestLinkFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		blockLinks  bool
+		wantAllowed bool
+	}{
+		{"plain text", "see you at the close", true, true},
+		{"url with scheme", "join https://example.com/x", true, false},
+		{"telegram link", "tg://resolve?domain=signals", true, false},
+		{"www", "go to www.example.org", true, false},
+		{"bare domain", "my site is signals.io now", true, false},
+		{"cyrillic domain", "пример.рф", true, false},
+		{"subdomain", "vip.signals.com", true, false},
+		{"links allowed", "join https://example.com/x", false, true},
+		{"decimal number", "gold at 2350.50", true, true},
+		{"sentence end", "I like it.Then again", true, true},
+		{"email like word", "ends with.company", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := LinkFilter{}.Check(context.Background(), Message{Text: tt.text, Rules: Rules{BlockLinks: tt.blockLinks}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verdict.Allowed != tt.wantAllowed {
+				t.Errorf("Check(%q) allowed = %t, want %t", tt.text, verdict.Allowed, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	errClassifier := errors.New("classifier down")
+	allow := Func(func(ctx context.Context, message Message) (Verdict, error) { return Allow, nil })
+	reject := func(reason string) Filter {
+		return Func(func(ctx context.Context, message Message) (Verdict, error) { return Reject(reason), nil })
+	}
+	failing := Func(func(ctx context.Context, message Message) (Verdict, error) { return Verdict{}, errClassifier })
+
+	tests := []struct {
+		name        string
+		chain       Chain
+		wantVerdict Verdict
+		wantErr     error
+	}{
+		{"empty chain", Chain{}, Allow, nil},
+		{"all allow", Chain{allow, allow}, Allow, nil},
+		{"first rejection wins", Chain{allow, reject("first"), reject("second")}, Reject("first"), nil},
+		{"rejection before failure", Chain{reject("first"), failing}, Reject("first"), nil},
+		{"failure stops the chain", Chain{failing, reject("second")}, Verdict{}, errClassifier},
+		{"built-in filters", Chain{NewWordFilter([]string{"scam"}), LinkFilter{}}, Reject("Links are not allowed in this room"), nil},
+	}
+
+	message := Message{Text: "no scams at www.example.com", Rules: Rules{BlockLinks: true}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := tt.chain.Check(context.Background(), message)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+			if verdict != tt.wantVerdict {
+				t.Errorf("Check() = %+v, want %+v", verdict, tt.wantVerdict)
+			}
+		})
+	}
+}
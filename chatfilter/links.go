@@ -0,0 +1,21 @@
+package chatfilter
+
+import (
+	"context"
+	"regexp"
+)
+
+// URLs with a scheme or "www.", and bare domains of common top level domains. Go has no Unicode
+// aware \b, the domain boundaries are spelled out so "пример.рф" is caught as well.
+var linkPattern = regexp.MustCompile(`(?i)(https?|ftp|tg)://\S+|(^|[^\p{L}\p{N}])www\.\S+|` +
+	`(^|[^\p{L}\p{N}.-])[\p{L}\p{N}-]+(\.[\p{L}\p{N}-]+)*\.(com|net|org|info|biz|io|co|me|app|dev|xyz|ru|рф|ua|by|kz|uk|de|tv|gg|ly|to|cc|link|site|online|shop|store)($|[^\p{L}\p{N}])`)
+
+// LinkFilter rejects messages containing links in rooms which block them
+type LinkFilter struct{}
+
+func (LinkFilter) Check(ctx context.Context, message Message) (Verdict, error) {
+	if message.Rules.BlockLinks && linkPattern.MatchString(message.Text) {
+		return Reject("Links are not allowed in this room"), nil
+	}
+	return Allow, nil
+}
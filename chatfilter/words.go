@@ -0,0 +1,51 @@
+package chatfilter
+
+import (
+	"context"
+	"streaming/search"
+	"strings"
+)
+
+// WordFilter rejects messages containing banned words or phrases. Matching works on whole words
+// after Unicode normalization, so case, diacritics and compatibility forms like fullwidth letters
+// don't get around it while "class" is not caught by "ass".
+type WordFilter struct {
+	global [][]string
+}
+
+func NewWordFilter(bannedWords []string) *WordFilter {
+	return &WordFilter{global: phrases(bannedWords)}
+}
+
+func (w *WordFilter) Check(ctx context.Context, message Message) (Verdict, error) {
+	tokens := search.Tokenize(message.Text)
+	for _, banned := range [][][]string{w.global, phrases(message.Rules.BannedWords)} {
+		for _, phrase := range banned {
+			if containsPhrase(tokens, phrase) {
+				return Reject("Message contains a banned word"), nil
+			}
+		}
+	}
+	return Allow, nil
+}
+
+// phrases tokenizes banned words the same way messages are, entries without words are dropped
+func phrases(words []string) [][]string {
+	out := make([][]string, 0, len(words))
+	for _, word := range words {
+		if tokens := search.Tokenize(word); len(tokens) > 0 {
+			out = append(out, tokens)
+		}
+	}
+	return out
+}
+
+// containsPhrase reports whether phrase occurs in tokens as consecutive words
+func containsPhrase(tokens, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(tokens); i++ {
+		if strings.Join(tokens[i:i+len(phrase)], " ") == strings.Join(phrase, " ") {
+			return true
+		}
+	}
+	return false
+}
@@ -5,7 +5,9 @@ import (
 	"log"
 	"os"
 	"streaming/api"
+	"streaming/controllers"
 	"streaming/initializers"
+	"streaming/search"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -21,7 +23,41 @@ func main() {
 		os.Exit(1)
 	}
 
-	fmt.Println("config: ", *config)
+	if err := config.LiveKit.ParseTokenLifetimes(); err != nil {
+		fmt.Printf("Error configuring livekit tokens: %s\n", err)
+		os.Exit(1)
+	}
+
+	if config.Search.Backend != "memory" {
+		controllers.RoomSearch = search.NewRedisIndex(initializers.RedisClient)
+	}
+
+	backendClient, err := initializers.NewBackendClient(config)
+	if err != nil {
+		fmt.Printf("Error configuring backend client: %s\n", err)
+		os.Exit(1)
+	}
+	controllers.Backend = backendClient
+
+	products, err := initializers.NewProductCatalog(config, backendClient)
+	if err != nil {
+		fmt.Printf("Error configuring product catalog: %s\n", err)
+		os.Exit(1)
+	}
+	controllers.Products = products
+
+	liveKit, err := initializers.NewLiveKitClient(config)
+	if err != nil {
+		fmt.Printf("Error configuring livekit client: %s\n", err)
+		os.Exit(1)
+	}
+	controllers.LiveKit = liveKit
+
+	controllers.ChatFilter = initializers.NewChatFilter(config)
+	controllers.Subscriptions = initializers.NewSubscriptionChecker(config, backendClient)
+
+	// Ends live rooms whose publisher disappeared or which expire, safe to run on every replica
+	controllers.StartRoomReaper(initializers.Ctx, config)
 
 	app := fiber.New(fiber.Config{
 		ServerHeader: "PaxStreaming",
@@ -34,7 +70,7 @@ func main() {
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "*",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, Access-Control-Allow-Headers, Session, Mode",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, Access-Control-Allow-Headers, Session, Mode, X-Metadata-Version, Idempotency-Key",
 		AllowMethods:     "GET, POST, PATCH, DELETE",
 		AllowCredentials: false,
 	}))
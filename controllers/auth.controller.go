@@ -1,22 +1,24 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"streaming/initializers"
 	"streaming/middleware"
 	"streaming/utils"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"gopkg.in/square/go-jose.v2/jwt"
+	"github.com/redis/go-redis/v9"
 )
 
 func GenerateToken(c *fiber.Ctx, config *initializers.Config) error {
 
 	// Define the struct to get livekit Token
+	// The role comes from the room, the isSreamer flag older clients still send is ignored
 	type RequestData struct {
-		RoomId     string `json:"roomId"`
-		IsStreamer bool   `json:"isSreamer"`
+		RoomId string `json:"roomId"`
 	}
 
 	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
@@ -38,7 +40,32 @@ func GenerateToken(c *fiber.Ctx, config *initializers.Config) error {
 		})
 	}
 
-	livekitToken, err := utils.CreateToken(requestData.IsStreamer, requestData.RoomId, user.ID, user.Name, user.Photo, config)
+	roomDetails, err := getRoomDetails(requestData.RoomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	if banned, err := isBanned(requestData.RoomId, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room bans",
+		})
+	} else if banned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are banned from this room",
+		})
+	}
+
+	livekitToken, err := utils.CreateToken(roomRole(user, roomDetails), requestData.RoomId, user.ID, user.Name, participantMetadata(c, config, user), config)
 
 	if err != nil {
 		// Handler case when user details are not properly set or wrong type
@@ -57,31 +84,105 @@ func GenerateToken(c *fiber.Ctx, config *initializers.Config) error {
 }
 
 func RefreshToken(c *fiber.Ctx, config *initializers.Config) error {
-	token := c.Get("token")
-	tokenStr, err := jwt.ParseSigned(token)
-	if err != nil {
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "failed to parse token",
+			"message": "Server error while retrieving user details",
 		})
 	}
-	claims := &jwt.Claims{}
-	secret := config.LiveKit.APISecret
-	if err := tokenStr.Claims([]byte(secret), claims); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+
+	token := c.Get("token")
+	if token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
-			"message": "failed to parse token",
+			"message": "Missing token",
 		})
 	}
-	expired := claims.Expiry.Time().Before(time.Now())
-	if expired {
-		return GenerateToken(c, config)
-	} else {
+
+	roomId, expiresAt, due, err := utils.CheckRefresh(token, user.ID, config)
+	if errors.Is(err, utils.ErrTokenExpired) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Token expired, join the room again",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid token",
+		})
+	}
+	if !due {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"status": "success",
 			"data": fiber.Map{
-				"token": token,
+				"token":     token,
+				"refreshed": false,
+				"expiresAt": expiresAt,
 			},
 		})
 	}
+
+	// The new token gets the role the user has in the room now, a removed co-host or moderator loses it here
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	// A banned participant must not stay in the room by refreshing an old token
+	if banned, err := isBanned(roomId, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room bans",
+		})
+	} else if banned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are banned from this room",
+		})
+	}
+
+	role := roomRole(user, roomDetails)
+	livekitToken, err := utils.CreateToken(role, roomId, user.ID, user.Name, participantMetadata(c, config, user), config)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error while refreshing Livekit Token",
+		})
+	}
+	expiresAt = time.Now().Add(utils.TokenTTL(role, config))
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"token":     livekitToken,
+			"refreshed": true,
+			"expiresAt": expiresAt,
+		},
+	})
+}
+
+// participantMetadata describes the user in the metadata format the client understands
+func participantMetadata(c *fiber.Ctx, config *initializers.Config, user middleware.UserDetailsResponse) utils.ParticipantMetadata {
+	version := config.LiveKit.MetadataVersion
+	if requested, err := strconv.Atoi(c.Get("X-Metadata-Version")); err == nil && (requested == utils.MetadataV1 || requested == utils.MetadataV2) {
+		version = requested
+	}
+
+	return utils.ParticipantMetadata{
+		Version:      version,
+		Avatar:       user.Photo,
+		Role:         user.Role,
+		TelegramName: user.TelegramName,
+		Verified:     user.Verified,
+	}
 }
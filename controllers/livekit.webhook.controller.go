@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/webhook"
+	"github.com/redis/go-redis/v9"
+)
+
+func LivekitWebhook(c *fiber.Ctx, config *initializers.Config) error {
+	req, err := adaptor.ConvertRequest(c, false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to read webhook request",
+		})
+	}
+
+	// Verify that the payload was signed by our LiveKit server
+	provider := auth.NewSimpleKeyProvider(config.LiveKit.APIKey, config.LiveKit.APISecret)
+	event, err := webhook.ReceiveWebhookEvent(req, provider)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Invalid webhook: %v", err),
+		})
+	}
+
+	// Egress events carry no room, only the egress info
+	switch event.GetEvent() {
+	case webhook.EventEgressStarted, webhook.EventEgressUpdated, webhook.EventEgressEnded:
+		if err := onEgressUpdated(livekitapi.EgressFromInfo(event.GetEgressInfo()), config); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to handle %s event: %v", event.GetEvent(), err),
+			})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status": "success",
+		})
+	}
+
+	roomId := event.GetRoom().GetName()
+	if roomId == "" {
+		// Events which are not bound to a room are not interesting for us
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status": "success",
+		})
+	}
+
+	switch event.GetEvent() {
+	case webhook.EventRoomStarted:
+		err = onRoomStarted(roomId, event)
+	case webhook.EventRoomFinished:
+		err = onRoomFinished(roomId, config)
+	case webhook.EventParticipantJoined:
+		err = onParticipantJoined(roomId, event)
+	case webhook.EventParticipantLeft:
+		err = onParticipantLeft(roomId, event)
+	case webhook.EventTrackPublished:
+		err = onTrackPublished(roomId, event, true)
+	case webhook.EventTrackUnpublished:
+		err = onTrackPublished(roomId, event, false)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to handle %s event: %v", event.GetEvent(), err),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+	})
+}
+
+func onRoomStarted(roomId string, event *livekit.WebhookEvent) error {
+	startedAt := event.GetRoom().GetCreationTime()
+	if startedAt == 0 {
+		startedAt = time.Now().Unix()
+	}
+	return updateRoomState(roomId, func(pipe redis.Pipeliner, key string) {
+		pipe.HSet(initializers.Ctx, key, "startedAt", startedAt)
+	})
+}
+
+func onParticipantJoined(roomId string, event *livekit.WebhookEvent) error {
+	identity := event.GetParticipant().GetIdentity()
+
+	// Tokens issued before a ban stay valid until they expire, the banned participant is removed again
+	banned, err := isBanned(roomId, identity)
+	if err != nil {
+		return err
+	}
+	if banned {
+		if err := LiveKit.RemoveParticipant(initializers.Ctx, roomId, identity); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	publisherId, err := roomPublisherID(roomId)
+	if err != nil {
+		return err
+	}
+	// The publisher is not counted as a viewer of its own stream
+	if identity == publisherId {
+		return nil
+	}
+
+	// Unique viewers for the archive, a rejoin is counted once
+	viewersKey := roomViewersPrefix + roomId
+	_, err = initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.PFAdd(initializers.Ctx, viewersKey, identity)
+		pipe.Expire(initializers.Ctx, viewersKey, roomTTL)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return addRoomViewer(roomId, identity)
+}
+
+func onParticipantLeft(roomId string, event *livekit.WebhookEvent) error {
+	identity := event.GetParticipant().GetIdentity()
+	publisherId, err := roomPublisherID(roomId)
+	if err != nil {
+		return err
+	}
+	if identity == publisherId {
+		return updateRoomState(roomId, func(pipe redis.Pipeliner, key string) {
+			pipe.HSet(initializers.Ctx, key, "publishing", false)
+		})
+	}
+	// Kicked banned participants were never counted, removing them changes nothing
+	return removeRoomViewer(roomId, identity)
+}
+
+func onTrackPublished(roomId string, event *livekit.WebhookEvent, publishing bool) error {
+	publisherId, err := roomPublisherID(roomId)
+	if err != nil {
+		return err
+	}
+	// Only the tracks of the room owner tell us whether the stream is actually live
+	if event.GetParticipant().GetIdentity() != publisherId {
+		return nil
+	}
+	return updateRoomState(roomId, func(pipe redis.Pipeliner, key string) {
+		pipe.HSet(initializers.Ctx, key, "publishing", publishing)
+	})
+}
+
+func onRoomFinished(roomId string, config *initializers.Config) error {
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		// Room was already removed through DeleteTradingRoom or expired
+		_, err = initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(initializers.Ctx, roomStatePrefix+roomId, roomPresentPrefix+roomId, roomViewersPrefix+roomId)
+			unregisterRoom(pipe, roomId)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return RoomSearch.Remove(initializers.Ctx, roomId)
+	} else if err != nil {
+		return err
+	}
+
+	// Somebody joined a scheduled room early, the announcement stays
+	if roomStatus(roomDetails) != RoomLive {
+		return initializers.RedisClient.Del(initializers.Ctx, roomStatePrefix+roomId, roomPresentPrefix+roomId).Err()
+	}
+
+	return endRoom(initializers.Ctx, roomId, roomDetails, config)
+}
+
+// roomPublisherID returns the identity of the user who created the room
+func roomPublisherID(roomId string) (string, error) {
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return roomDetails.Publisher.ID, nil
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"streaming/livekitapi"
+	"testing"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+)
+
+// kickingLiveKit records the participants removed from rooms
+type kickingLiveKit struct {
+	livekitapi.Client
+	removed []string
+}
+
+func (k *kickingLiveKit) RemoveParticipant(ctx context.Context, roomId, identity string) error {
+	k.removed = append(k.removed, identity)
+	return nil
+}
+
+func participantEvent(identity string) *livekit.WebhookEvent {
+	return &livekit.WebhookEvent{Participant: &livekit.ParticipantInfo{Identity: identity}}
+}
+
+func TestParticipantWebhooksBannedRejoin(t *testing.T) {
+	mr, _ := setupServices(t)
+	liveKit := &kickingLiveKit{}
+	LiveKit = liveKit
+	liveRoom(t, "room", time.Minute, roomTTL, true)
+	mr.HDel(roomStatePrefix+"room", "peakViewers")
+
+	steps := []struct {
+		name        string
+		event       func(roomId string, event *livekit.WebhookEvent) error
+		identity    string
+		ban         bool
+		wantViewers string
+	}{
+		{name: "viewer joins", event: onParticipantJoined, identity: "good", wantViewers: "1"},
+		{name: "abuser joins", event: onParticipantJoined, identity: "bad", wantViewers: "2"},
+		{name: "duplicate join", event: onParticipantJoined, identity: "bad", wantViewers: "2"},
+		{name: "publisher joins", event: onParticipantJoined, identity: "owner", wantViewers: "2"},
+		{name: "abuser is banned and removed", event: onParticipantLeft, identity: "bad", ban: true, wantViewers: "1"},
+		{name: "abuser rejoins with the old token", event: onParticipantJoined, identity: "bad", wantViewers: "1"},
+		{name: "kicked abuser leaves", event: onParticipantLeft, identity: "bad", wantViewers: "1"},
+		{name: "kicked abuser leaves twice", event: onParticipantLeft, identity: "bad", wantViewers: "1"},
+		{name: "viewer leaves", event: onParticipantLeft, identity: "good", wantViewers: "0"},
+		{name: "unknown participant leaves", event: onParticipantLeft, identity: "stranger", wantViewers: "0"},
+	}
+
+	for _, step := range steps {
+		if step.ban {
+			mr.HSet(bansPrefix+"room", step.identity, "{}")
+		}
+		if err := step.event("room", participantEvent(step.identity)); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := mr.HGet(roomStatePrefix+"room", "viewers"); got != step.wantViewers {
+			t.Errorf("%s: viewers = %q, want %q", step.name, got, step.wantViewers)
+		}
+	}
+
+	if !reflect.DeepEqual(liveKit.removed, []string{"bad"}) {
+		t.Errorf("removed %q, want the banned participant once", liveKit.removed)
+	}
+	if got := mr.HGet(roomStatePrefix+"room", "peakViewers"); got != "2" {
+		t.Errorf("peak viewers = %q, want 2", got)
+	}
+}
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"streaming/chatfilter"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"streaming/middleware"
+	"streaming/subscriptions"
+	"streaming/utils"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Capped stream of the chat messages of a room
+	chatPrefix = "chat:"
+	// Fixed window counter of the messages a user sent to a room, "chat_rate:<roomId>:<userId>"
+	chatRatePrefix = "chat_rate:"
+)
+
+// Counts a message and starts the window with the first one, returns the count and the window left in ms
+var chatRateScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {count, redis.call('PTTL', KEYS[1])}
+`)
+
+// ChatMessage is a stored chat message, ID is its stream entry ID and orders the history
+type ChatMessage struct {
+	ID     string    `json:"id"`
+	UserID string    `json:"userId"`
+	Name   string    `json:"name"`
+	Avatar string    `json:"avatar,omitempty"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sentAt"`
+}
+
+func SendChatMessage(c *fiber.Ctx, config *initializers.Config) error {
+	type RequestData struct {
+		Text string `json:"text"`
+	}
+
+	roomId := c.Params("roomId")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	requestData := new(RequestData)
+	if err := c.BodyParser(requestData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to parse request body: %v", err),
+		})
+	}
+	text := strings.TrimSpace(requestData.Text)
+	if text == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Message can't be empty",
+		})
+	}
+	if utf8.RuneCountInString(text) > config.Chat.MaxMessageLength() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Message is longer than %d characters", config.Chat.MaxMessageLength()),
+		})
+	}
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+	if roomStatus(roomDetails) != RoomLive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Room is %s", roomStatus(roomDetails)),
+		})
+	}
+
+	if banned, err := isBanned(roomId, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room bans",
+		})
+	} else if banned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are banned from this room",
+		})
+	}
+
+	settings, err := loadChatSettings(roomId, config)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching chat settings",
+		})
+	}
+
+	// Checked before the filter so messages of non-subscribers never reach an external classifier
+	if settings.SubscribersOnly && !canModerateRoom(user, roomDetails) {
+		subscribed, err := isSubscriber(c, roomDetails.Publisher.ID, user.ID)
+		if errors.Is(err, subscriptions.ErrDisabled) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Subscriber-only chat is not available",
+			})
+		} else if err != nil {
+			return backendFailure(c, err)
+		}
+		if !subscribed {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Only subscribers can chat in this room",
+			})
+		}
+	}
+
+	verdict, err := ChatFilter.Check(c.Context(), chatfilter.Message{
+		RoomID: roomId,
+		UserID: user.ID,
+		Text:   text,
+		Rules: chatfilter.Rules{
+			BannedWords: settings.BannedWords,
+			BlockLinks:  settings.BlockLinks,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to review chat message in room %s: %v", roomId, err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Message could not be reviewed, try again",
+		})
+	}
+	if !verdict.Allowed {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"status":  "error",
+			"message": verdict.Reason,
+		})
+	}
+
+	// The owner and moderators are not limited. Messages are filtered first so rejected ones
+	// don't use up the rate limit or the slow mode interval
+	if !canModerateRoom(user, roomDetails) {
+		limit, window := config.Chat.Rate()
+		result, err := chatRateScript.Run(initializers.Ctx, initializers.RedisClient,
+			[]string{chatRatePrefix + roomId + ":" + user.ID}, window.Milliseconds()).Int64Slice()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error checking rate limit",
+			})
+		}
+		if result[0] > int64(limit) {
+			return tooManyMessages(c, time.Duration(result[1])*time.Millisecond, fmt.Sprintf("You can send %d messages every %s", limit, window))
+		}
+
+		wait, err := takeSlowModeTurn(roomId, user.ID, settings)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error checking slow mode",
+			})
+		}
+		if wait > 0 {
+			return tooManyMessages(c, wait, fmt.Sprintf("Slow mode is on, you can send a message every %d seconds", settings.SlowModeSeconds))
+		}
+	}
+
+	message := ChatMessage{
+		UserID: user.ID,
+		Name:   user.Name,
+		Avatar: user.Photo,
+		Text:   text,
+		SentAt: time.Now(),
+	}
+	if message.ID, err = storeChatMessage(roomId, message, config); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to store message",
+		})
+	}
+
+	// Participants which miss the message read it from GetChatHistory
+	if err := broadcastRoomEvent(c.Context(), roomId, EventChatMessage, message); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+		log.Printf("Failed to relay chat message of room %s: %v", roomId, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   message,
+	})
+}
+
+// GetChatHistory returns the messages of a room newest first, "before" pages back from a message ID
+func GetChatHistory(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
+	limit := utils.ParseLimit(c.Query("limit"))
+
+	// Stream IDs are "<ms>-<seq>", anything else would make XREVRANGE fail
+	end := "+"
+	if before := c.Query("before"); before != "" {
+		if !validStreamID(before) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid before",
+			})
+		}
+		end = "(" + before
+	}
+
+	entries, err := initializers.RedisClient.XRevRangeN(initializers.Ctx, chatPrefix+roomId, end, "-", int64(limit)).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching chat history",
+		})
+	}
+
+	messages := make([]ChatMessage, 0, len(entries))
+	for _, entry := range entries {
+		value, _ := entry.Values["message"].(string)
+		var message ChatMessage
+		if err := json.Unmarshal([]byte(value), &message); err != nil {
+			continue
+		}
+		message.ID = entry.ID
+		messages = append(messages, message)
+	}
+
+	nextBefore := ""
+	if len(entries) == limit {
+		nextBefore = entries[len(entries)-1].ID
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   messages,
+		"meta": fiber.Map{
+			"limit":      limit,
+			"nextBefore": nextBefore,
+		},
+	})
+}
+
+// tooManyMessages answers with 429 and the seconds to wait in Retry-After
+func tooManyMessages(c *fiber.Ctx, wait time.Duration, message string) error {
+	retryAfter := (wait + time.Second - 1) / time.Second
+	c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(int64(retryAfter), 10))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"status":  "error",
+		"message": message,
+	})
+}
+
+// storeChatMessage appends a message to the capped chat stream of a room and returns its ID
+func storeChatMessage(roomId string, message ChatMessage, config *initializers.Config) (string, error) {
+	messageJSON, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+
+	key := chatPrefix + roomId
+	var add *redis.StringCmd
+	_, err = initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+		add = pipe.XAdd(initializers.Ctx, &redis.XAddArgs{
+			Stream: key,
+			MaxLen: config.Chat.MaxMessagesPerRoom(),
+			Approx: true,
+			Values: map[string]interface{}{"message": messageJSON},
+		})
+		pipe.Expire(initializers.Ctx, key, config.Chat.RetentionDuration())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return add.Val(), nil
+}
+
+// validStreamID reports whether id looks like a Redis stream entry ID
+func validStreamID(id string) bool {
+	ms, seq, found := strings.Cut(id, "-")
+	if _, err := strconv.ParseUint(ms, 10, 64); err != nil {
+		return false
+	}
+	if !found {
+		return true
+	}
+	_, err := strconv.ParseUint(seq, 10, 64)
+	return err == nil
+}
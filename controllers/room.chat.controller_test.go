@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"streaming/backend"
+	"streaming/chatfilter"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"streaming/middleware"
+	"streaming/subscriptions"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// quietLiveKit drops the data messages rooms are sent
+type quietLiveKit struct {
+	livekitapi.Client
+}
+
+func (quietLiveKit) SendData(ctx context.Context, roomId, topic string, data []byte, identities []string) error {
+	return nil
+}
+
+// chatApp serves SendChatMessage to the given user
+func chatApp(user middleware.UserDetailsResponse, config *initializers.Config) *fiber.App {
+	app := fiber.New()
+	app.Post("/chat/:roomId", func(c *fiber.Ctx) error {
+		c.Locals("userDetails", user)
+		return SendChatMessage(c, config)
+	})
+	return app
+}
+
+func sendChat(t *testing.T, app *fiber.App, roomId, text string) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/chat/"+roomId, strings.NewReader(`{"text":"`+text+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("sending %q: %v", text, err)
+	}
+	return res.StatusCode
+}
+
+func TestSendChatMessageFilter(t *testing.T) {
+	type message struct {
+		text string
+		want int
+	}
+	tests := []struct {
+		name      string
+		slowMode  bool
+		filterErr error
+		messages  []message
+	}{
+		{
+			name: "rejected messages don't count towards the rate limit",
+			messages: []message{
+				{"spam", fiber.StatusUnprocessableEntity},
+				{"spam", fiber.StatusUnprocessableEntity},
+				{"spam", fiber.StatusUnprocessableEntity},
+				{"hello", fiber.StatusOK},
+				{"hello", fiber.StatusOK},
+				{"hello", fiber.StatusTooManyRequests},
+			},
+		},
+		{
+			name:     "rejected messages don't start the slow mode interval",
+			slowMode: true,
+			messages: []message{
+				{"spam", fiber.StatusUnprocessableEntity},
+				{"hello", fiber.StatusOK},
+				{"spam", fiber.StatusUnprocessableEntity},
+				{"hello", fiber.StatusTooManyRequests},
+			},
+		},
+		{
+			name:      "filter failure",
+			filterErr: errInjected,
+			messages: []message{
+				{"hello", fiber.StatusServiceUnavailable},
+				{"hello", fiber.StatusServiceUnavailable},
+				{"hello", fiber.StatusServiceUnavailable},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, _ := setupServices(t)
+			LiveKit = quietLiveKit{}
+			liveRoom(t, "room", time.Minute, roomTTL, true)
+			if tt.slowMode {
+				mr.Set(chatSettingsPrefix+"room", `{"slowModeSeconds":30}`)
+			}
+
+			var checked []string
+			ChatFilter = chatfilter.Func(func(ctx context.Context, message chatfilter.Message) (chatfilter.Verdict, error) {
+				checked = append(checked, message.Text)
+				if tt.filterErr != nil {
+					return chatfilter.Verdict{}, tt.filterErr
+				}
+				if message.Text == "spam" {
+					return chatfilter.Reject("No spam"), nil
+				}
+				return chatfilter.Allow, nil
+			})
+
+			config := &initializers.Config{Chat: initializers.ChatConfig{RateLimit: 2, RateWindow: "1m"}}
+			app := chatApp(middleware.UserDetailsResponse{ID: "viewer", Name: "Ben"}, config)
+			for i, m := range tt.messages {
+				if got := sendChat(t, app, "room", m.text); got != m.want {
+					t.Errorf("message %d %q: status %d, want %d", i, m.text, got, m.want)
+				}
+			}
+			if len(checked) != len(tt.messages) {
+				t.Errorf("filter saw %d messages, want %d", len(checked), len(tt.messages))
+			}
+		})
+	}
+}
+
+func TestSendChatMessageFilterAppliesToModerators(t *testing.T) {
+	setupServices(t)
+	LiveKit = quietLiveKit{}
+	liveRoom(t, "room", time.Minute, roomTTL, true)
+	ChatFilter = chatfilter.Chain{
+		chatfilter.Func(func(ctx context.Context, message chatfilter.Message) (chatfilter.Verdict, error) {
+			return chatfilter.Reject("Not today"), nil
+		}),
+		chatfilter.Func(func(ctx context.Context, message chatfilter.Message) (chatfilter.Verdict, error) {
+			return chatfilter.Verdict{}, errors.New("chain went past a rejection")
+		}),
+	}
+
+	app := chatApp(middleware.UserDetailsResponse{ID: "owner"}, &initializers.Config{})
+	if got := sendChat(t, app, "room", "hello"); got != fiber.StatusUnprocessableEntity {
+		t.Errorf("status %d, want %d", got, fiber.StatusUnprocessableEntity)
+	}
+}
+
+func TestSendChatMessageSubscribersOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       string
+		subscribed bool
+		checkErr   error
+		disabled   bool
+		want       int
+	}{
+		{name: "subscriber", user: "viewer", subscribed: true, want: fiber.StatusOK},
+		{name: "not subscribed", user: "viewer", want: fiber.StatusForbidden},
+		{name: "owner needs no subscription", user: "owner", want: fiber.StatusOK},
+		{name: "checker times out", user: "viewer", checkErr: &backend.Error{Op: "check subscriber", Err: backend.ErrTimeout}, want: fiber.StatusGatewayTimeout},
+		{name: "no subscription source", user: "viewer", disabled: true, want: fiber.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, _ := setupServices(t)
+			LiveKit = quietLiveKit{}
+			liveRoom(t, "room", time.Minute, roomTTL, true)
+			mr.Set(chatSettingsPrefix+"room", `{"subscribersOnly":true}`)
+
+			checks := 0
+			Subscriptions = subscriptions.Func(func(ctx context.Context, publisherId, userId string) (bool, error) {
+				checks++
+				if publisherId != "owner" || userId != tt.user {
+					t.Errorf("checked %s with %s", userId, publisherId)
+				}
+				return tt.subscribed, tt.checkErr
+			})
+			if tt.disabled {
+				Subscriptions = subscriptions.Disabled{}
+			}
+			filtered := 0
+			ChatFilter = chatfilter.Func(func(ctx context.Context, message chatfilter.Message) (chatfilter.Verdict, error) {
+				filtered++
+				return chatfilter.Allow, nil
+			})
+
+			app := chatApp(middleware.UserDetailsResponse{ID: tt.user}, &initializers.Config{})
+			for i := 0; i < 2; i++ {
+				if got := sendChat(t, app, "room", "hello"); got != tt.want {
+					t.Fatalf("message %d: status %d, want %d", i, got, tt.want)
+				}
+			}
+			if tt.want != fiber.StatusOK && filtered != 0 {
+				t.Errorf("filter saw %d refused messages", filtered)
+			}
+			if tt.want == fiber.StatusOK && tt.user != "owner" && checks != 1 {
+				t.Errorf("subscription checked %d times, want the answer cached", checks)
+			}
+		})
+	}
+}
+
+func TestUpdateChatSettingsSubscribersOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		checker  subscriptions.Checker
+		want     int
+		wantMode bool
+	}{
+		{"source configured", subscriptions.Func(func(ctx context.Context, publisherId, userId string) (bool, error) { return true, nil }), fiber.StatusOK, true},
+		{"no source", subscriptions.Disabled{}, fiber.StatusUnprocessableEntity, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupServices(t)
+			Subscriptions = tt.checker
+			liveRoom(t, "room", time.Minute, roomTTL, true)
+			config := &initializers.Config{}
+
+			app := fiber.New()
+			app.Patch("/chat/:roomId/settings", func(c *fiber.Ctx) error {
+				c.Locals("userDetails", middleware.UserDetailsResponse{ID: "owner"})
+				return UpdateChatSettings(c, config)
+			})
+			req := httptest.NewRequest("PATCH", "/chat/room/settings", strings.NewReader(`{"subscribersOnly":true}`))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", res.StatusCode, tt.want)
+			}
+			settings, err := loadChatSettings("room", config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if settings.SubscribersOnly != tt.wantMode {
+				t.Errorf("subscribersOnly = %t, want %t", settings.SubscribersOnly, tt.wantMode)
+			}
+		})
+	}
+}
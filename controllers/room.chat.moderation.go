@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"streaming/middleware"
+	"streaming/subscriptions"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Chat settings of a room, missing until moderators change the defaults
+	chatSettingsPrefix = "chat_settings:"
+	// Set while a user has to wait in slow mode, "chat_slow:<roomId>:<userId>"
+	chatSlowPrefix = "chat_slow:"
+	// Cached subscription of a user to a publisher, "chat_subscriber:<publisherId>:<userId>"
+	chatSubscriberPrefix = "chat_subscriber:"
+)
+
+// How long a subscription answer is cached
+const chatSubscriberTTL = 5 * time.Minute
+
+// Longest slow mode interval moderators may set
+const maxSlowModeSeconds = 3600
+
+// ChatSettings are the moderation settings of a room chat. Owner and moderators are exempt
+// from slow mode and subscriber-only mode, not from the word and link filters.
+type ChatSettings struct {
+	// Seconds a user waits between messages, 0 disables slow mode
+	SlowModeSeconds int `json:"slowModeSeconds"`
+	// Only subscribers of the publisher may chat, needs chat.subscriptions_uri
+	SubscribersOnly bool `json:"subscribersOnly"`
+	BlockLinks      bool `json:"blockLinks"`
+	// Words and phrases banned in this room on top of chat.banned_words, only shown to moderators
+	BannedWords []string `json:"bannedWords,omitempty"`
+}
+
+func GetChatSettings(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	settings, err := loadChatSettings(roomId, config)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching chat settings",
+		})
+	}
+
+	// The banned words would tell people how to get around them
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok || !canModerateRoom(user, roomDetails) {
+		settings.BannedWords = nil
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   settings,
+	})
+}
+
+func UpdateChatSettings(c *fiber.Ctx, config *initializers.Config) error {
+	// Fields left out stay as they are
+	type RequestData struct {
+		SlowModeSeconds *int      `json:"slowModeSeconds"`
+		SubscribersOnly *bool     `json:"subscribersOnly"`
+		BlockLinks      *bool     `json:"blockLinks"`
+		BannedWords     *[]string `json:"bannedWords"`
+	}
+
+	user, roomDetails, ok, err := moderatedRoom(c)
+	if !ok {
+		return err
+	}
+	roomId := c.Params("roomId")
+
+	requestData := new(RequestData)
+	if err := c.BodyParser(requestData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to parse request body: %v", err),
+		})
+	}
+	if requestData.SlowModeSeconds != nil && (*requestData.SlowModeSeconds < 0 || *requestData.SlowModeSeconds > maxSlowModeSeconds) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("slowModeSeconds must be between 0 and %d", maxSlowModeSeconds),
+		})
+	}
+	if requestData.SubscribersOnly != nil && *requestData.SubscribersOnly && !subscriptions.Available(Subscriptions) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Subscriber-only chat is not available, no subscription source is configured",
+		})
+	}
+
+	settings, err := loadChatSettings(roomId, config)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching chat settings",
+		})
+	}
+	if requestData.SlowModeSeconds != nil {
+		settings.SlowModeSeconds = *requestData.SlowModeSeconds
+	}
+	if requestData.SubscribersOnly != nil {
+		settings.SubscribersOnly = *requestData.SubscribersOnly
+	}
+	if requestData.BlockLinks != nil {
+		settings.BlockLinks = *requestData.BlockLinks
+	}
+	if requestData.BannedWords != nil {
+		settings.BannedWords = []string{}
+		for _, word := range *requestData.BannedWords {
+			if word = strings.TrimSpace(word); word != "" {
+				settings.BannedWords = append(settings.BannedWords, word)
+			}
+		}
+	}
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to encode chat settings",
+		})
+	}
+	// Kept as long as the room
+	if err := initializers.RedisClient.Set(initializers.Ctx, chatSettingsPrefix+roomId, settingsJSON, storedRoomTTL(roomDetails)).Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to store chat settings",
+		})
+	}
+	audit(roomId, ActionChatSettings, user, "", fiber.Map{
+		"slowModeSeconds": settings.SlowModeSeconds,
+		"subscribersOnly": settings.SubscribersOnly,
+		"blockLinks":      settings.BlockLinks,
+		"bannedWords":     len(settings.BannedWords),
+	}, config)
+
+	// Clients adapt their input, the banned words stay with the moderators
+	public := *settings
+	public.BannedWords = nil
+	if err := broadcastRoomEvent(c.Context(), roomId, EventChatSettings, public); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+		log.Printf("Failed to announce chat settings of room %s: %v", roomId, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   settings,
+	})
+}
+
+// DeleteChatMessage removes a message from the history and tells clients to replace it with a tombstone
+func DeleteChatMessage(c *fiber.Ctx, config *initializers.Config) error {
+	user, _, ok, err := moderatedRoom(c)
+	if !ok {
+		return err
+	}
+	roomId, messageId := c.Params("roomId"), c.Params("messageId")
+
+	if !validStreamID(messageId) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid message ID",
+		})
+	}
+
+	// The text goes to the audit log, it is gone from the chat afterwards
+	entries, err := initializers.RedisClient.XRange(initializers.Ctx, chatPrefix+roomId, messageId, messageId).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching message",
+		})
+	}
+	if len(entries) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Message not found",
+		})
+	}
+	var message ChatMessage
+	value, _ := entries[0].Values["message"].(string)
+	json.Unmarshal([]byte(value), &message)
+
+	if err := initializers.RedisClient.XDel(initializers.Ctx, chatPrefix+roomId, messageId).Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete message",
+		})
+	}
+	audit(roomId, ActionChatDelete, user, message.UserID, fiber.Map{"messageId": messageId, "text": message.Text}, config)
+
+	tombstone := fiber.Map{"id": messageId, "deletedBy": user.ID}
+	if err := broadcastRoomEvent(c.Context(), roomId, EventChatMessageDeleted, tombstone); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+		log.Printf("Failed to announce deleted message of room %s: %v", roomId, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   tombstone,
+	})
+}
+
+// loadChatSettings returns the chat settings of a room, or the defaults from the config
+func loadChatSettings(roomId string, config *initializers.Config) (*ChatSettings, error) {
+	settings := &ChatSettings{BlockLinks: config.Chat.BlockLinks}
+	val, err := initializers.RedisClient.Get(initializers.Ctx, chatSettingsPrefix+roomId).Result()
+	if err == redis.Nil {
+		return settings, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(val), settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// takeSlowModeTurn reports how long the user still has to wait, and starts a new interval when 0
+func takeSlowModeTurn(roomId, userId string, settings *ChatSettings) (time.Duration, error) {
+	if settings.SlowModeSeconds <= 0 {
+		return 0, nil
+	}
+	key := chatSlowPrefix + roomId + ":" + userId
+	interval := time.Duration(settings.SlowModeSeconds) * time.Second
+	taken, err := initializers.RedisClient.SetNX(initializers.Ctx, key, 1, interval).Result()
+	if err != nil || taken {
+		return 0, err
+	}
+	wait, err := initializers.RedisClient.PTTL(initializers.Ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if wait <= 0 {
+		wait = interval
+	}
+	return wait, nil
+}
+
+// isSubscriber asks Subscriptions whether the user subscribed to the publisher, answers are cached
+func isSubscriber(c *fiber.Ctx, publisherId, userId string) (bool, error) {
+	key := chatSubscriberPrefix + publisherId + ":" + userId
+	if cached, err := initializers.RedisClient.Get(initializers.Ctx, key).Result(); err == nil {
+		return cached == "1", nil
+	}
+
+	subscribed, err := Subscriptions.IsSubscriber(c.Context(), publisherId, userId)
+	if err != nil {
+		return false, err
+	}
+	initializers.RedisClient.Set(initializers.Ctx, key, subscribed, chatSubscriberTTL)
+	return subscribed, nil
+}
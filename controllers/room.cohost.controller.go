@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"streaming/middleware"
+	"streaming/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Pending co-host invitation of an identity, "cohost_invite:<roomId>:<identity>"
+const coHostInvitePrefix = "cohost_invite:"
+
+var errCoHostLimit = errors.New("room has the maximum number of co-hosts")
+
+// CoHostInvite is a pending invitation to go on stage
+type CoHostInvite struct {
+	Identity  string    `json:"identity"`
+	InvitedBy string    `json:"invitedBy"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// InviteCoHost invites a participant of a live room on stage, the invitation expires after rooms.cohost_invite_ttl
+func InviteCoHost(c *fiber.Ctx, config *initializers.Config) error {
+	roomId, identity := c.Params("roomId"), c.Params("identity")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	if !canManageRoom(user, roomDetails) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not the owner of this room",
+		})
+	}
+	if roomStatus(roomDetails) != RoomLive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Room is %s", roomStatus(roomDetails)),
+		})
+	}
+	if identity == roomDetails.Publisher.ID || contains(roomDetails.CoHosts, identity) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Participant is already on stage",
+		})
+	}
+	if len(roomDetails.CoHosts) >= config.Rooms.MaxCoHostsPerRoom() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Room already has %d co-hosts", len(roomDetails.CoHosts)),
+		})
+	}
+	if banned, err := isBanned(roomId, identity); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room bans",
+		})
+	} else if banned {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Participant is banned from this room",
+		})
+	}
+
+	ttl := config.Rooms.CoHostInviteDuration()
+	invite := CoHostInvite{
+		Identity:  identity,
+		InvitedBy: user.ID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	inviteJSON, err := json.Marshal(invite)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to encode invitation",
+		})
+	}
+	if err := initializers.RedisClient.Set(initializers.Ctx, coHostInviteKey(roomId, identity), inviteJSON, ttl).Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to store invitation",
+		})
+	}
+	audit(roomId, ActionCoHostInvite, user, identity, nil, config)
+
+	// Only the invited participant is told, it answers through AcceptCoHostInvite
+	notified := true
+	if err := broadcastRoomEvent(c.Context(), roomId, EventCoHostInvited, invite, identity); err != nil {
+		notified = false
+		if !errors.Is(err, livekitapi.ErrNotFound) {
+			log.Printf("Failed to send co-host invitation of room %s: %v", roomId, err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"invite":   invite,
+			"notified": notified,
+		},
+	})
+}
+
+// AcceptCoHostInvite puts the invited user on stage and answers with a co-host token. A connected
+// participant gets the co-host permissions right away, the token is for reconnecting. Co-host tokens
+// are short-lived, refreshing drops the publish rights once the co-host was removed.
+func AcceptCoHostInvite(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	inviteKey := coHostInviteKey(roomId, user.ID)
+	exists, err := initializers.RedisClient.Exists(initializers.Ctx, inviteKey).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching invitation",
+		})
+	}
+	if exists == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "No pending invitation",
+		})
+	}
+
+	// The cap is checked again here, several invitations may be pending at once
+	updated, err := updateRoomDetails(c.Context(), roomId, func(roomDetails *RoomDetails) error {
+		if roomStatus(roomDetails) != RoomLive {
+			return redis.Nil
+		}
+		if contains(roomDetails.CoHosts, user.ID) {
+			return nil
+		}
+		if len(roomDetails.CoHosts) >= config.Rooms.MaxCoHostsPerRoom() {
+			return errCoHostLimit
+		}
+		roomDetails.CoHosts = append(roomDetails.CoHosts, user.ID)
+		return nil
+	})
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if errors.Is(err, errCoHostLimit) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room already has the maximum number of co-hosts",
+		})
+	} else if errors.Is(err, errRoomChanged) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room was changed meanwhile, try again",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to add co-host: %v", err),
+		})
+	}
+	initializers.RedisClient.Del(initializers.Ctx, inviteKey)
+	audit(roomId, ActionCoHostAdd, user, user.ID, nil, config)
+
+	if err := applyRoomRole(c, roomId, user.ID, utils.RoleCoHost, config); err != nil {
+		log.Printf("Failed to upgrade co-host %s in room %s: %v", user.ID, roomId, err)
+	}
+	if err := broadcastRoomEvent(c.Context(), roomId, EventCoHostAdded, fiber.Map{"identity": user.ID}); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+		log.Printf("Failed to announce co-host of room %s: %v", roomId, err)
+	}
+
+	livekitToken, err := utils.CreateToken(utils.RoleCoHost, roomId, user.ID, user.Name, participantMetadata(c, config, user), config)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error while Generating Livekit Token",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"token":     livekitToken,
+			"expiresAt": time.Now().Add(utils.TokenTTL(utils.RoleCoHost, config)),
+			"coHosts":   updated.CoHosts,
+		},
+	})
+}
+
+// RemoveCoHost takes a co-host off stage, or withdraws a pending invitation. The owner may remove
+// anybody, co-hosts only themselves.
+func RemoveCoHost(c *fiber.Ctx, config *initializers.Config) error {
+	roomId, identity := c.Params("roomId"), c.Params("identity")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	if identity != user.ID && !canManageRoom(user, roomDetails) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not the owner of this room",
+		})
+	}
+
+	invites, err := initializers.RedisClient.Del(initializers.Ctx, coHostInviteKey(roomId, identity)).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to withdraw invitation",
+		})
+	}
+
+	wasCoHost, err := removeCoHost(c, roomId, identity)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to remove co-host: %v", err),
+		})
+	}
+	if !wasCoHost && invites == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Participant is neither co-host nor invited",
+		})
+	}
+
+	if wasCoHost {
+		audit(roomId, ActionCoHostRemove, user, identity, nil, config)
+		// Back to the role the participant would join with
+		role := roomRole(middleware.UserDetailsResponse{ID: identity}, roomDetails)
+		if role == utils.RoleCoHost {
+			role = utils.RoleViewer
+		}
+		if err := applyRoomRole(c, roomId, identity, role, config); err != nil {
+			return liveKitFailure(c, err)
+		}
+		if err := broadcastRoomEvent(c.Context(), roomId, EventCoHostRemoved, fiber.Map{"identity": identity}); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+			log.Printf("Failed to announce co-host removal of room %s: %v", roomId, err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+	})
+}
+
+// removeCoHost drops identity from the co-hosts of a room and reports whether it was one
+func removeCoHost(c *fiber.Ctx, roomId, identity string) (bool, error) {
+	removed := false
+	_, err := updateRoomDetails(c.Context(), roomId, func(roomDetails *RoomDetails) error {
+		coHosts := make([]string, 0, len(roomDetails.CoHosts))
+		for _, coHost := range roomDetails.CoHosts {
+			if coHost == identity {
+				removed = true
+			} else {
+				coHosts = append(coHosts, coHost)
+			}
+		}
+		roomDetails.CoHosts = coHosts
+		return nil
+	})
+	return removed, err
+}
+
+// applyRoomRole gives a connected participant the permissions of a room role,
+// participants which are not connected get them with their next token
+func applyRoomRole(c *fiber.Ctx, roomId, identity, role string, config *initializers.Config) error {
+	grant, err := utils.NewVideoGrant(role, roomId, config)
+	if err != nil {
+		return err
+	}
+	err = LiveKit.UpdateParticipantPermission(c.Context(), roomId, identity, grant)
+	if errors.Is(err, livekitapi.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func coHostInviteKey(roomId, identity string) string {
+	return coHostInvitePrefix + roomId + ":" + identity
+}
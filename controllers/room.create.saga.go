@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"streaming/backend"
+	"streaming/initializers"
+	"streaming/utils"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Maps a share link slug to its room ID
+const slugPrefix = "slug:"
+
+const maxSlugAttempts = 5
+
+var errRoomTaken = errors.New("room is owned by another publisher")
+
+// Stores the room details and registers the room as live, unless another publisher already owns the
+// room ID. Returns the details it replaced, or an empty string.
+var storeRoomScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current then
+	local ok, room = pcall(cjson.decode, current)
+	if ok and type(room.publisher) == 'table' and room.publisher.userID ~= ARGV[2] then
+		return redis.error_reply('ROOM_TAKEN')
+	end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+redis.call('ZADD', KEYS[2], ARGV[4], ARGV[5])
+redis.call('ZREM', KEYS[3], ARGV[5])
+return current or ''
+`)
+
+// createRoomSteps lists the side effects of CreateTradingRoom in the order they are applied
+func createRoomSteps(roomId string, roomDetails *RoomDetails, streaming backend.Streaming, config *initializers.Config) []utils.SagaStep {
+	// Set by the steps, used to undo only what they changed
+	var reservedSlug, extendedSlug, registered bool
+	var previousSlugTTL time.Duration
+	var previous, previousArchive string
+
+	return []utils.SagaStep{
+		{
+			// Short ID for share links, resolved by GET /streaming/r/:slug
+			Name: "reserve slug",
+			Do: func(ctx context.Context) error {
+				// A promoted scheduled room keeps the link it was announced with
+				if roomDetails.Slug != "" {
+					ttl, err := initializers.RedisClient.PTTL(ctx, slugPrefix+roomDetails.Slug).Result()
+					if err != nil {
+						return err
+					}
+					if err := initializers.RedisClient.Expire(ctx, slugPrefix+roomDetails.Slug, roomTTL).Err(); err != nil {
+						return err
+					}
+					previousSlugTTL, extendedSlug = ttl, true
+					return nil
+				}
+
+				slug, err := reserveSlug(roomId, roomTTL)
+				if err != nil {
+					return err
+				}
+				roomDetails.Slug = slug
+				reservedSlug = true
+				return nil
+			},
+			Undo: func(ctx context.Context) error {
+				key := slugPrefix + roomDetails.Slug
+				switch {
+				case reservedSlug:
+					return initializers.RedisClient.Del(ctx, key).Err()
+				// The room stays scheduled, so does its link
+				case extendedSlug && previousSlugTTL > 0:
+					return initializers.RedisClient.PExpire(ctx, key, previousSlugTTL).Err()
+				case extendedSlug && previousSlugTTL == -1:
+					return initializers.RedisClient.Persist(ctx, key).Err()
+				}
+				return nil
+			},
+		},
+		{
+			// Room details and registry entry are written in one Lua script
+			Name: "store room",
+			Do: func(ctx context.Context) error {
+				roomDetailsJSON, err := json.Marshal(roomDetails)
+				if err != nil {
+					return err
+				}
+
+				keys := []string{"room:" + roomId, activeRoomsKey, scheduledRoomsKey}
+				previous, err = storeRoomScript.Run(ctx, initializers.RedisClient, keys,
+					roomDetailsJSON, streaming.UserID, roomTTL.Milliseconds(), streaming.CreatedAt.UnixMilli(), roomId).Text()
+				if err != nil && strings.HasSuffix(err.Error(), "ROOM_TAKEN") {
+					return errRoomTaken
+				}
+				return err
+			},
+			Undo: func(ctx context.Context) error {
+				_, err := initializers.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+					restoreRoom(pipe, roomId, previous)
+					return nil
+				})
+				return err
+			},
+		},
+		{
+			// Make the room discoverable through /streaming/rooms/search
+			Name: "index room",
+			Do: func(ctx context.Context) error {
+				return RoomSearch.Put(ctx, roomId, searchDocument(*roomDetails))
+			},
+			Undo: func(ctx context.Context) error {
+				return RoomSearch.Remove(ctx, roomId)
+			},
+		},
+		{
+			// Draft of the record listed by /streaming/rooms/history once the stream ends
+			Name: "archive room",
+			Do: func(ctx context.Context) error {
+				previousArchive, _ = initializers.RedisClient.Get(ctx, historyRoomPrefix+roomId).Result()
+				_, err := initializers.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+					return startArchive(pipe, roomId, roomDetails, streaming.CreatedAt, config)
+				})
+				return err
+			},
+			Undo: func(ctx context.Context) error {
+				_, err := initializers.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+					if previousArchive != "" {
+						pipe.Set(ctx, historyRoomPrefix+roomId, previousArchive, config.History.RetentionDuration())
+						return nil
+					}
+					discardArchive(pipe, roomId, roomDetails.Publisher.ID)
+					return nil
+				})
+				return err
+			},
+		},
+		{
+			Name: "register streaming",
+			Do: func(ctx context.Context) error {
+				err := Backend.CreateStreaming(ctx, streaming)
+				// The backend may have stored the stream before timing out, it is ended to be sure
+				registered = err == nil || errors.Is(err, backend.ErrTimeout)
+				return err
+			},
+			Undo: func(ctx context.Context) error {
+				if !registered {
+					return nil
+				}
+				err := Backend.EndStreaming(ctx, roomId, streaming.UserID, time.Now())
+				if backend.IsNotFound(err) {
+					return nil
+				}
+				return err
+			},
+			UndoFailed: true,
+		},
+	}
+}
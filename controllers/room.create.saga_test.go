@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"reflect"
+	"streaming/backend"
+	"streaming/initializers"
+	"streaming/middleware"
+	"streaming/search"
+	"streaming/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var errInjected = errors.New("injected failure")
+
+// stubBackend records the streams it is told about, CreateStreaming fails with createErr and EndStreaming with endErr
+type stubBackend struct {
+	createErr error
+	endErr    error
+	created   []string
+	ended     []string
+}
+
+func (b *stubBackend) CreateStreaming(ctx context.Context, streaming backend.Streaming) error {
+	b.created = append(b.created, streaming.RoomID)
+	return b.createErr
+}
+
+func (b *stubBackend) EndStreaming(ctx context.Context, roomId, userId string, endedAt time.Time) error {
+	b.ended = append(b.ended, roomId)
+	return b.endErr
+}
+
+func (b *stubBackend) ListStreamings(ctx context.Context, query url.Values) (*backend.StreamingPage, error) {
+	return &backend.StreamingPage{}, nil
+}
+
+func (b *stubBackend) FilterProductsByIds(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error) {
+	return json.RawMessage("[]"), nil
+}
+
+// failingIndex is a search index which can't store documents
+type failingIndex struct {
+	search.Index
+}
+
+func (idx failingIndex) Put(ctx context.Context, roomId string, doc search.Document) error {
+	return errInjected
+}
+
+// failKeys is a Redis hook failing every command and pipeline which touches a key with prefix
+type failKeys struct {
+	prefix string
+}
+
+func (h failKeys) touches(cmd redis.Cmder) bool {
+	for _, arg := range cmd.Args()[1:] {
+		if s, ok := arg.(string); ok && strings.HasPrefix(s, h.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h failKeys) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h failKeys) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if h.touches(cmd) {
+			cmd.SetErr(errInjected)
+			return errInjected
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h failKeys) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if h.touches(cmd) {
+				return errInjected
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// setupServices points the controllers at miniredis, an in-memory index and a stub backend
+func setupServices(t *testing.T) (*miniredis.Miniredis, *stubBackend) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	initializers.RedisClient = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	initializers.Ctx = context.Background()
+	RoomSearch = search.NewMemoryIndex()
+	stub := &stubBackend{}
+	Backend = stub
+	return mr, stub
+}
+
+func newSagaRoom() (*RoomDetails, backend.Streaming) {
+	roomDetails := &RoomDetails{
+		Publisher: middleware.UserDetailsResponse{ID: "owner", Name: "Anna"},
+		Title:     "Gold trading",
+		Status:    RoomLive,
+	}
+	return roomDetails, backend.Streaming{Title: roomDetails.Title, RoomID: "room", UserID: "owner", CreatedAt: time.Now()}
+}
+
+func TestCreateRoomSteps(t *testing.T) {
+	mr, stub := setupServices(t)
+	roomDetails, streaming := newSagaRoom()
+
+	if err := utils.RunSaga(context.Background(), createRoomSteps("room", roomDetails, streaming, &initializers.Config{})); err != nil {
+		t.Fatalf("RunSaga() = %v", err)
+	}
+
+	if roomDetails.Slug == "" || !mr.Exists(slugPrefix+roomDetails.Slug) {
+		t.Errorf("slug %q was not reserved", roomDetails.Slug)
+	}
+	for _, key := range []string{"room:room", historyRoomPrefix + "room", historyUserPrefix + "owner"} {
+		if !mr.Exists(key) {
+			t.Errorf("%s was not written", key)
+		}
+	}
+	if results, _ := RoomSearch.Search(context.Background(), "gold", 0); len(results) != 1 {
+		t.Errorf("search results = %v, want the room", results)
+	}
+	if !reflect.DeepEqual(stub.created, []string{"room"}) {
+		t.Errorf("backend streams = %q, want the room", stub.created)
+	}
+}
+
+func TestCreateRoomStepsRollback(t *testing.T) {
+	tests := []struct {
+		name string
+		step string
+		// Makes the step fail, the other steps work
+		arrange func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend)
+		// Slug of the scheduled room being promoted
+		slug string
+		// Whether the backend was told to end a stream it may have stored
+		wantEnded bool
+		// Compensations which are expected to fail
+		wantUndoErrors int
+	}{
+		{
+			name: "slug reservation fails",
+			step: "reserve slug",
+			arrange: func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend) {
+				initializers.RedisClient.AddHook(failKeys{prefix: slugPrefix})
+			},
+		},
+		{
+			name: "room ID is taken",
+			step: "store room",
+			arrange: func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend) {
+				// The room ID belongs to another publisher, which must keep it untouched
+				taken, _ := json.Marshal(RoomDetails{Publisher: middleware.UserDetailsResponse{ID: "someone else"}, Title: "Theirs"})
+				mr.Set("room:room", string(taken))
+			},
+		},
+		{
+			name: "index fails",
+			step: "index room",
+			arrange: func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend) {
+				RoomSearch = failingIndex{RoomSearch}
+			},
+		},
+		{
+			name: "archive fails",
+			step: "archive room",
+			arrange: func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend) {
+				initializers.RedisClient.AddHook(failKeys{prefix: "history:"})
+			},
+		},
+		{
+			name: "backend rejects stream",
+			step: "register streaming",
+			arrange: func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend) {
+				stub.createErr = &backend.Error{Op: "create streaming", Err: &backend.StatusError{StatusCode: 500}}
+			},
+		},
+		{
+			name: "backend times out",
+			step: "register streaming",
+			arrange: func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend) {
+				stub.createErr = &backend.Error{Op: "create streaming", Err: backend.ErrTimeout}
+			},
+			wantEnded: true,
+		},
+		{
+			name: "backend times out and ending fails",
+			step: "register streaming",
+			arrange: func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend) {
+				stub.createErr = &backend.Error{Op: "create streaming", Err: backend.ErrTimeout}
+				stub.endErr = &backend.Error{Op: "end streaming", Err: &backend.StatusError{StatusCode: 503}}
+			},
+			wantEnded:      true,
+			wantUndoErrors: 1,
+		},
+		{
+			name: "backend times out without storing",
+			step: "register streaming",
+			arrange: func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend) {
+				stub.createErr = &backend.Error{Op: "create streaming", Err: backend.ErrTimeout}
+				stub.endErr = &backend.Error{Op: "end streaming", Err: &backend.StatusError{StatusCode: 404}}
+			},
+			wantEnded: true,
+		},
+		{
+			name: "promoted scheduled room",
+			step: "register streaming",
+			slug: "gold",
+			arrange: func(t *testing.T, mr *miniredis.Miniredis, stub *stubBackend) {
+				startAt := time.Now().Add(24 * time.Hour)
+				scheduled, _ := json.Marshal(RoomDetails{Publisher: middleware.UserDetailsResponse{ID: "owner"}, Title: "Gold", Slug: "gold", Status: RoomScheduled, StartAt: &startAt})
+				mr.Set("room:room", string(scheduled))
+				mr.ZAdd(scheduledRoomsKey, float64(startAt.UnixMilli()), "room")
+				mr.Set(slugPrefix+"gold", "room")
+				mr.SetTTL(slugPrefix+"gold", 48*time.Hour)
+				stub.createErr = &backend.Error{Op: "create streaming", Err: &backend.StatusError{StatusCode: 500}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, stub := setupServices(t)
+			tt.arrange(t, mr, stub)
+			before := dumpRedis(mr)
+			roomDetails, streaming := newSagaRoom()
+			roomDetails.Slug = tt.slug
+			// Share links of rooms which stay scheduled must not expire earlier
+			slugTTLs := make(map[string]time.Duration)
+			for _, key := range mr.Keys() {
+				if strings.HasPrefix(key, slugPrefix) {
+					slugTTLs[key] = mr.TTL(key)
+				}
+			}
+
+			err := utils.RunSaga(context.Background(), createRoomSteps("room", roomDetails, streaming, &initializers.Config{}))
+
+			var sagaErr *utils.SagaError
+			if !errors.As(err, &sagaErr) || sagaErr.Step != tt.step {
+				t.Fatalf("RunSaga() = %v, want step %q to fail", err, tt.step)
+			}
+			if len(sagaErr.UndoErrors) != tt.wantUndoErrors {
+				t.Errorf("rollback errors = %v, want %d", sagaErr.UndoErrors, tt.wantUndoErrors)
+			}
+			for key, ttl := range slugTTLs {
+				if got := mr.TTL(key); got != ttl {
+					t.Errorf("TTL of %s after rollback = %s, want %s", key, got, ttl)
+				}
+			}
+			if after := dumpRedis(mr); !reflect.DeepEqual(after, before) {
+				t.Errorf("Redis after rollback = %v, want %v", after, before)
+			}
+			if results, _ := RoomSearch.Search(context.Background(), "gold", 0); len(results) != 0 {
+				t.Errorf("search results after rollback = %v, want none", results)
+			}
+			if ended := len(stub.ended) > 0; ended != tt.wantEnded {
+				t.Errorf("backend stream ended = %v, want %v", ended, tt.wantEnded)
+			}
+		})
+	}
+}
+
+// dumpRedis returns the string keys with their values and every other key with its type
+func dumpRedis(mr *miniredis.Miniredis) map[string]string {
+	dump := make(map[string]string)
+	for _, key := range mr.Keys() {
+		if value, err := mr.Get(key); err == nil {
+			dump[key] = value
+		} else {
+			dump[key] = mr.Type(key)
+		}
+	}
+	return dump
+}
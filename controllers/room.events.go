@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Data channel topic of the messages the server sends into a room
+const roomEventsTopic = "room-events"
+
+// Types of RoomEvent
+const (
+	EventProductPinned   = "product_pinned"
+	EventProductUnpinned = "product_unpinned"
+	EventCoHostInvited   = "cohost_invited"
+	EventCoHostAdded     = "cohost_added"
+	EventCoHostRemoved   = "cohost_removed"
+	EventChatMessage     = "chat_message"
+	// Clients replace the message with a tombstone
+	EventChatMessageDeleted = "chat_message_deleted"
+	EventChatSettings       = "chat_settings"
+)
+
+// RoomEvent is the envelope of every server message on roomEventsTopic, clients switch on Type
+type RoomEvent struct {
+	Type   string      `json:"type"`
+	RoomID string      `json:"roomId"`
+	Data   interface{} `json:"data"`
+	SentAt time.Time   `json:"sentAt"`
+}
+
+// broadcastRoomEvent sends an event to the given identities of a room, or to all participants when there are none
+func broadcastRoomEvent(ctx context.Context, roomId, eventType string, data interface{}, identities ...string) error {
+	payload, err := json.Marshal(RoomEvent{
+		Type:   eventType,
+		RoomID: roomId,
+		Data:   data,
+		SentAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return LiveKit.SendData(ctx, roomId, roomEventsTopic, payload, identities)
+}
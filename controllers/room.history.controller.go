@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strconv"
+	"streaming/initializers"
+	"streaming/middleware"
+	"streaming/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Archive record of a room by room ID
+	historyRoomPrefix = "history:room:"
+	// Sorted set of the archived room IDs of a publisher scored by start time in milliseconds
+	historyUserPrefix = "history:user:"
+	// HyperLogLog of the viewer identities of a room
+	roomViewersPrefix = "room_viewers:"
+)
+
+// ArchivedRoom is what is left of a room once its stream ended
+type ArchivedRoom struct {
+	RoomID        string                         `json:"roomId"`
+	Title         string                         `json:"title"`
+	Publisher     middleware.UserDetailsResponse `json:"publisher"`
+	Products      json.RawMessage                `json:"products"`
+	CoverImage    string                         `json:"coverImage,omitempty"`
+	StartedAt     time.Time                      `json:"startedAt"`
+	EndedAt       *time.Time                     `json:"endedAt"` // Nil while the stream is live
+	PeakViewers   int64                          `json:"peakViewers"`
+	UniqueViewers int64                          `json:"uniqueViewers"`
+}
+
+func GetRoomHistory(c *fiber.Ctx, config *initializers.Config) error {
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	// Publishers see their own history, admins anybody's
+	userId := c.Query("userId", user.ID)
+	if userId != user.ID && !user.IsAdmin() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You can only see your own streams",
+		})
+	}
+
+	cursor, err := utils.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid cursor",
+		})
+	}
+	limit := utils.ParseLimit(c.Query("limit"))
+
+	roomIds, next, err := pageSortedSet(historyUserPrefix+userId, cursor, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching history",
+		})
+	}
+
+	archived, err := getArchivedRooms(userId, roomIds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching history",
+		})
+	}
+
+	nextCursor := ""
+	if next != nil {
+		nextCursor = next.Encode()
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   archived,
+		"meta": fiber.Map{
+			"limit":      limit,
+			"nextCursor": nextCursor,
+		},
+	})
+}
+
+// getArchivedRooms loads archive records in the given order, records past retention are dropped
+func getArchivedRooms(userId string, roomIds []string) ([]ArchivedRoom, error) {
+	archived := []ArchivedRoom{}
+	if len(roomIds) == 0 {
+		return archived, nil
+	}
+
+	keys := make([]string, len(roomIds))
+	for i, roomId := range roomIds {
+		keys[i] = historyRoomPrefix + roomId
+	}
+	values, err := initializers.RedisClient.MGet(initializers.Ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []interface{}
+	for i, value := range values {
+		val, ok := value.(string)
+		if !ok {
+			expired = append(expired, roomIds[i])
+			continue
+		}
+
+		var record ArchivedRoom
+		if err := json.Unmarshal([]byte(val), &record); err != nil {
+			continue
+		}
+
+		// The room expired without being ended, it ended at the latest when its TTL ran out
+		if record.EndedAt == nil {
+			if exists, _ := initializers.RedisClient.Exists(initializers.Ctx, "room:"+record.RoomID).Result(); exists == 0 {
+				endedAt := record.StartedAt.Add(roomTTL)
+				if endedAt.After(time.Now()) {
+					endedAt = time.Now()
+				}
+				record.EndedAt = &endedAt
+			}
+		}
+		archived = append(archived, record)
+	}
+
+	if len(expired) > 0 {
+		initializers.RedisClient.ZRem(initializers.Ctx, historyUserPrefix+userId, expired...)
+	}
+	return archived, nil
+}
+
+// startArchive writes the archive record of a room going live, it is completed by finishArchive
+func startArchive(pipe redis.Pipeliner, roomId string, roomDetails *RoomDetails, startedAt time.Time, config *initializers.Config) error {
+	record := ArchivedRoom{
+		RoomID:     roomId,
+		Title:      roomDetails.Title,
+		Publisher:  roomDetails.Publisher,
+		Products:   roomDetails.Products,
+		CoverImage: roomDetails.CoverImage,
+		StartedAt:  startedAt,
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	retention := config.History.RetentionDuration()
+	userKey := historyUserPrefix + roomDetails.Publisher.ID
+	pipe.Set(initializers.Ctx, historyRoomPrefix+roomId, recordJSON, retention)
+	pipe.ZAdd(initializers.Ctx, userKey, redis.Z{Score: float64(startedAt.UnixMilli()), Member: roomId})
+
+	// Keep the per publisher index within retention
+	pipe.ZRemRangeByScore(initializers.Ctx, userKey, "-inf", strconv.FormatInt(time.Now().Add(-retention).UnixMilli(), 10))
+	pipe.ZRemRangeByRank(initializers.Ctx, userKey, 0, int64(-config.History.MaxRecordsPerUser()-1))
+	pipe.Expire(initializers.Ctx, userKey, retention)
+	return nil
+}
+
+// discardArchive removes the archive record of a room that never went live
+func discardArchive(pipe redis.Pipeliner, roomId, publisherId string) {
+	pipe.Del(initializers.Ctx, historyRoomPrefix+roomId)
+	pipe.ZRem(initializers.Ctx, historyUserPrefix+publisherId, roomId)
+}
+
+// finishArchive completes the archive record of an ended room with its end time and viewer stats,
+// it must run before the room state is deleted
+func finishArchive(roomId string, roomDetails *RoomDetails, config *initializers.Config) error {
+	var record ArchivedRoom
+	val, err := initializers.RedisClient.Get(initializers.Ctx, historyRoomPrefix+roomId).Result()
+	if err == nil {
+		err = json.Unmarshal([]byte(val), &record)
+	}
+	if err != nil {
+		// Rooms created before the archive existed get a record now
+		_, err = initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+			return startArchive(pipe, roomId, roomDetails, time.Now(), config)
+		})
+		if err != nil {
+			return err
+		}
+		record = ArchivedRoom{
+			RoomID:    roomId,
+			Title:     roomDetails.Title,
+			Publisher: roomDetails.Publisher,
+			Products:  roomDetails.Products,
+			StartedAt: time.Now(),
+		}
+	}
+
+	states, err := loadLiveStates([]string{roomId})
+	if err != nil {
+		return err
+	}
+	state := states[roomId]
+	if state != nil {
+		record.PeakViewers = state.PeakViewers
+		if state.StartedAt != nil && state.StartedAt.Before(record.StartedAt) {
+			record.StartedAt = *state.StartedAt
+		}
+	}
+	record.UniqueViewers, _ = initializers.RedisClient.PFCount(initializers.Ctx, roomViewersPrefix+roomId).Result()
+
+	endedAt := time.Now()
+	record.EndedAt = &endedAt
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return initializers.RedisClient.Set(initializers.Ctx, historyRoomPrefix+roomId, recordJSON, config.History.RetentionDuration()).Err()
+}
@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"streaming/middleware"
+	"streaming/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	errIngressExists  = errors.New("room already has an ingress")
+	errIngressChanged = errors.New("ingress of the room changed")
+)
+
+// RoomIngress is the RTMP or WHIP endpoint the publisher streams into the room through, from OBS for example.
+// The stream key is not stored, LiveKit hands it out to the owner with GetRoomIngress.
+type RoomIngress struct {
+	ID   string `json:"ingressId"`
+	Type string `json:"type"`
+	// LiveKit ingress state, filled on read by GetTradingRoom, never stored
+	Status string `json:"status,omitempty"`
+}
+
+// CreateRoomIngress creates an ingress which publishes as the publisher of the room and returns its URL and key.
+// The encoder and a browser can't publish at the same time, joining with the same identity takes over.
+func CreateRoomIngress(c *fiber.Ctx, config *initializers.Config) error {
+	type RequestData struct {
+		Type string `json:"type"`
+	}
+
+	roomId := c.Params("roomId")
+	user, roomDetails, ok, err := ownedRoom(c)
+	if !ok {
+		return err
+	}
+
+	var requestData RequestData
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&requestData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid request body",
+			})
+		}
+	}
+	if requestData.Type == "" {
+		requestData.Type = livekitapi.IngressRTMP
+	}
+	if !livekitapi.ValidIngressType(requestData.Type) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Ingress type must be %q or %q", livekitapi.IngressRTMP, livekitapi.IngressWHIP),
+		})
+	}
+	if roomDetails.Ingress != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room already has an ingress, rotate its key instead",
+		})
+	}
+
+	participant, err := ingressParticipant(roomDetails, config)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to create ingress: %v", err),
+		})
+	}
+	ingress, err := LiveKit.CreateIngress(c.Context(), roomId, requestData.Type, participant)
+	if err != nil {
+		return liveKitFailure(c, err)
+	}
+
+	_, err = updateRoomDetails(c.Context(), roomId, func(roomDetails *RoomDetails) error {
+		if roomDetails.Ingress != nil {
+			return errIngressExists
+		}
+		roomDetails.Ingress = &RoomIngress{ID: ingress.ID, Type: ingress.Type}
+		return nil
+	})
+	if err != nil {
+		// Another request created one first or the room is gone, the key must not stay usable
+		if err := LiveKit.DeleteIngress(initializers.Ctx, ingress.ID); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+			log.Printf("Failed to delete ingress %s of room %s: %v", ingress.ID, roomId, err)
+		}
+		return ingressUpdateFailure(c, err)
+	}
+	audit(roomId, ActionIngressCreate, user, roomDetails.Publisher.ID, fiber.Map{"ingressId": ingress.ID, "type": ingress.Type}, config)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   ingress,
+	})
+}
+
+// GetRoomIngress returns the URL, key and state of the ingress of a room to its owner
+func GetRoomIngress(c *fiber.Ctx, config *initializers.Config) error {
+	_, roomDetails, ok, err := ownedRoom(c)
+	if !ok {
+		return err
+	}
+	if roomDetails.Ingress == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room has no ingress",
+		})
+	}
+
+	ingress, err := LiveKit.GetIngress(c.Context(), roomDetails.Ingress.ID)
+	if errors.Is(err, livekitapi.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Ingress no longer exists, rotate its key to create a new one",
+		})
+	} else if err != nil {
+		return liveKitFailure(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   ingress,
+	})
+}
+
+// RotateRoomIngress replaces the ingress of a room by a new one of the same type, the old key stops working
+// and an encoder streaming with it is disconnected. LiveKit can't change the key of an existing ingress.
+func RotateRoomIngress(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
+	user, roomDetails, ok, err := ownedRoom(c)
+	if !ok {
+		return err
+	}
+	if roomDetails.Ingress == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room has no ingress",
+		})
+	}
+	previous := *roomDetails.Ingress
+
+	participant, err := ingressParticipant(roomDetails, config)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to create ingress: %v", err),
+		})
+	}
+	// The new one first, so a failure leaves the room with its working ingress
+	ingress, err := LiveKit.CreateIngress(c.Context(), roomId, previous.Type, participant)
+	if err != nil {
+		return liveKitFailure(c, err)
+	}
+
+	_, err = updateRoomDetails(c.Context(), roomId, func(roomDetails *RoomDetails) error {
+		if roomDetails.Ingress == nil || roomDetails.Ingress.ID != previous.ID {
+			return errIngressChanged
+		}
+		roomDetails.Ingress = &RoomIngress{ID: ingress.ID, Type: ingress.Type}
+		return nil
+	})
+	if err != nil {
+		if err := LiveKit.DeleteIngress(initializers.Ctx, ingress.ID); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+			log.Printf("Failed to delete ingress %s of room %s: %v", ingress.ID, roomId, err)
+		}
+		return ingressUpdateFailure(c, err)
+	}
+	audit(roomId, ActionIngressRotate, user, roomDetails.Publisher.ID, fiber.Map{"ingressId": ingress.ID, "previousIngressId": previous.ID}, config)
+
+	if err := LiveKit.DeleteIngress(c.Context(), previous.ID); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("New ingress %s was created but the old one could not be deleted: %v", ingress.ID, err),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   ingress,
+	})
+}
+
+// deleteRoomIngress removes the ingress of a room from LiveKit, one which is already gone is fine
+func deleteRoomIngress(ctx context.Context, roomDetails *RoomDetails) error {
+	if roomDetails.Ingress == nil {
+		return nil
+	}
+	err := LiveKit.DeleteIngress(ctx, roomDetails.Ingress.ID)
+	if errors.Is(err, livekitapi.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// loadIngressStatus fills the state of the ingress of a room, it is left empty when LiveKit can't tell
+func loadIngressStatus(ctx context.Context, roomDetails *RoomDetails) {
+	if roomDetails.Ingress == nil {
+		return
+	}
+	ingress, err := LiveKit.GetIngress(ctx, roomDetails.Ingress.ID)
+	if err != nil {
+		log.Printf("Failed to fetch ingress %s: %v", roomDetails.Ingress.ID, err)
+		return
+	}
+	roomDetails.Ingress.Status = ingress.Status
+}
+
+// ingressParticipant describes the publisher of the room the way their own token would
+func ingressParticipant(roomDetails *RoomDetails, config *initializers.Config) (livekitapi.IngressParticipant, error) {
+	publisher := roomDetails.Publisher
+	metadata, err := utils.ParticipantMetadata{
+		Version:      config.LiveKit.MetadataVersion,
+		Avatar:       publisher.Photo,
+		Role:         publisher.Role,
+		TelegramName: publisher.TelegramName,
+		Verified:     publisher.Verified,
+		RoomRole:     utils.RolePublisher,
+	}.Encode()
+	if err != nil {
+		return livekitapi.IngressParticipant{}, err
+	}
+	return livekitapi.IngressParticipant{
+		Identity: publisher.ID,
+		Name:     publisher.Name,
+		Metadata: metadata,
+	}, nil
+}
+
+// ownedRoom loads the room of the request and checks that the user is its owner or an admin.
+// When ok is false the error response has been written and err is to be returned.
+func ownedRoom(c *fiber.Ctx) (user middleware.UserDetailsResponse, roomDetails *RoomDetails, ok bool, err error) {
+	user, ok = c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return user, nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	roomDetails, err = getRoomDetails(c.Params("roomId"))
+	if err == redis.Nil {
+		return user, nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return user, nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	if !canManageRoom(user, roomDetails) {
+		return user, nil, false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not the owner of this room",
+		})
+	}
+	return user, roomDetails, true, nil
+}
+
+// ingressUpdateFailure writes the response for an ingress which could not be stored with the room
+func ingressUpdateFailure(c *fiber.Ctx, err error) error {
+	switch {
+	case err == redis.Nil:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	case errors.Is(err, errIngressExists), errors.Is(err, errIngressChanged), errors.Is(err, errRoomChanged):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Ingress of the room was changed meanwhile, try again",
+		})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to store ingress: %v", err),
+		})
+	}
+}
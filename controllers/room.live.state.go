@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"log"
+	"strconv"
+	"streaming/initializers"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Live state of a room as reported by LiveKit webhooks, kept next to "room:<id>"
+const roomStatePrefix = "room_state:"
+
+// Identities counted in the viewers of the room state, a leave only counts for a counted join
+const roomPresentPrefix = "room_present:"
+
+// LiveState holds the webhook-driven counters of a room
+type LiveState struct {
+	ViewerCount  int64      `json:"viewerCount"`
+	PeakViewers  int64      `json:"peakViewers"`
+	IsPublishing bool       `json:"isPublishing"`
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	// Last heartbeat of the publisher client, see RoomHeartbeat
+	LastHeartbeat *time.Time `json:"lastHeartbeat,omitempty"`
+}
+
+// Increments the viewer counter and keeps the peak in the same step, an identity
+// which is counted already is not counted again
+var addViewerScript = redis.NewScript(`
+local viewers = tonumber(redis.call('HGET', KEYS[1], 'viewers') or '0')
+if redis.call('SADD', KEYS[2], ARGV[2]) == 1 then
+	viewers = redis.call('HINCRBY', KEYS[1], 'viewers', 1)
+	local peak = tonumber(redis.call('HGET', KEYS[1], 'peakViewers') or '0')
+	if viewers > peak then
+		redis.call('HSET', KEYS[1], 'peakViewers', viewers)
+	end
+end
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+redis.call('EXPIRE', KEYS[2], ARGV[1])
+return viewers
+`)
+
+// Decrements the viewer counter for counted identities only, participants which were
+// never counted, like kicked banned ones, leave no trace
+var removeViewerScript = redis.NewScript(`
+local viewers = tonumber(redis.call('HGET', KEYS[1], 'viewers') or '0')
+if redis.call('SREM', KEYS[2], ARGV[1]) == 1 and viewers > 0 then
+	viewers = redis.call('HINCRBY', KEYS[1], 'viewers', -1)
+end
+return viewers
+`)
+
+// updateRoomState applies fn to the room state hash and refreshes its TTL
+func updateRoomState(roomId string, fn func(pipe redis.Pipeliner, key string)) error {
+	key := roomStatePrefix + roomId
+	_, err := initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+		fn(pipe, key)
+		pipe.Expire(initializers.Ctx, key, 12*time.Hour)
+		return nil
+	})
+	return err
+}
+
+func addRoomViewer(roomId, identity string) error {
+	ttl := int((12 * time.Hour).Seconds())
+	return addViewerScript.Run(initializers.Ctx, initializers.RedisClient, []string{roomStatePrefix + roomId, roomPresentPrefix + roomId}, ttl, identity).Err()
+}
+
+func removeRoomViewer(roomId, identity string) error {
+	return removeViewerScript.Run(initializers.Ctx, initializers.RedisClient, []string{roomStatePrefix + roomId, roomPresentPrefix + roomId}, identity).Err()
+}
+
+// loadLiveStates fetches the live state of all given rooms in a single round trip
+func loadLiveStates(roomIds []string) (map[string]*LiveState, error) {
+	states := make(map[string]*LiveState, len(roomIds))
+	if len(roomIds) == 0 {
+		return states, nil
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(roomIds))
+	_, err := initializers.RedisClient.Pipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+		for i, roomId := range roomIds {
+			cmds[i] = pipe.HGetAll(initializers.Ctx, roomStatePrefix+roomId)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, roomId := range roomIds {
+		states[roomId] = parseLiveState(cmds[i].Val())
+	}
+	return states, nil
+}
+
+func parseLiveState(fields map[string]string) *LiveState {
+	state := &LiveState{}
+	state.ViewerCount, _ = strconv.ParseInt(fields["viewers"], 10, 64)
+	state.PeakViewers, _ = strconv.ParseInt(fields["peakViewers"], 10, 64)
+	state.IsPublishing = fields["publishing"] == "1"
+	if startedAt, err := strconv.ParseInt(fields["startedAt"], 10, 64); err == nil && startedAt > 0 {
+		t := time.Unix(startedAt, 0)
+		state.StartedAt = &t
+	}
+	if heartbeatAt, err := strconv.ParseInt(fields["heartbeatAt"], 10, 64); err == nil && heartbeatAt > 0 {
+		t := time.Unix(heartbeatAt, 0)
+		state.LastHeartbeat = &t
+	}
+	return state
+}
+
+// attachLiveStates fills the live state of every listed room
+func attachLiveStates(rooms map[string]RoomDetails) {
+	roomIds := make([]string, 0, len(rooms))
+	for roomId := range rooms {
+		roomIds = append(roomIds, roomId)
+	}
+	// Listings still show the rooms, just without their live state
+	states, err := loadLiveStates(roomIds)
+	if err != nil {
+		log.Printf("Failed to load live state of %d rooms: %v", len(roomIds), err)
+	}
+	for roomId, roomDetails := range rooms {
+		roomDetails.Live = states[roomId]
+		rooms[roomId] = roomDetails
+	}
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"streaming/initializers"
+	"streaming/livekitapi"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// How often updateRoomDetails retries when the room changed while it was being updated
+const maxRoomUpdateAttempts = 3
+
+var errRoomChanged = errors.New("room changed concurrently")
+
+// RoomMetadata is what participants see in the LiveKit room metadata
+type RoomMetadata struct {
+	Title      string          `json:"title"`
+	Products   json.RawMessage `json:"products"`
+	CoverImage string          `json:"coverImage,omitempty"`
+}
+
+// updateRoomDetails applies fn to the stored room details and writes them back with their TTL kept.
+// Returns redis.Nil when the room does not exist, or disappeared meanwhile.
+func updateRoomDetails(ctx context.Context, roomId string, fn func(roomDetails *RoomDetails) error) (*RoomDetails, error) {
+	key := "room:" + roomId
+	var updated *RoomDetails
+
+	txf := func(tx *redis.Tx) error {
+		val, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		var roomDetails RoomDetails
+		if err := json.Unmarshal([]byte(val), &roomDetails); err != nil {
+			return err
+		}
+		if err := fn(&roomDetails); err != nil {
+			return err
+		}
+
+		roomDetailsJSON, err := json.Marshal(roomDetails)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			// XX so a room deleted meanwhile is not brought back without TTL
+			pipe.SetArgs(ctx, key, roomDetailsJSON, redis.SetArgs{Mode: "XX", KeepTTL: true})
+			return nil
+		})
+		updated = &roomDetails
+		return err
+	}
+
+	for attempt := 0; attempt < maxRoomUpdateAttempts; attempt++ {
+		err := initializers.RedisClient.Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return updated, nil
+	}
+	return nil, errRoomChanged
+}
+
+// pushRoomMetadata sends the current room details to the connected participants, it reports whether
+// they were notified. Rooms nobody joined yet have no LiveKit room, their participants read the details on join.
+func pushRoomMetadata(ctx context.Context, roomId string, roomDetails *RoomDetails) bool {
+	metadata, err := json.Marshal(RoomMetadata{
+		Title:      roomDetails.Title,
+		Products:   roomDetails.Products,
+		CoverImage: roomDetails.CoverImage,
+	})
+	if err != nil {
+		log.Printf("Failed to encode metadata of room %s: %v", roomId, err)
+		return false
+	}
+
+	err = LiveKit.UpdateRoomMetadata(ctx, roomId, string(metadata))
+	if err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+		log.Printf("Failed to push metadata of room %s: %v", roomId, err)
+		return false
+	}
+	return err == nil
+}
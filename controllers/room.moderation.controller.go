@@ -0,0 +1,401 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"streaming/middleware"
+	"streaming/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Hash of the banned identities of a room, values are BanEntry JSON
+	bansPrefix = "bans:"
+	// List of the moderation actions in a room, newest first
+	auditPrefix = "audit:"
+)
+
+// Entries kept per room in the audit log
+const maxAuditEntries = 1000
+
+// Moderation actions as written to the audit log
+const (
+	ActionKick  = "kick"
+	ActionMute  = "mute"
+	ActionBan   = "ban"
+	ActionUnban = "unban"
+	// Co-host changes, see room.cohost.controller.go
+	ActionCoHostInvite = "cohost_invite"
+	ActionCoHostAdd    = "cohost_add"
+	ActionCoHostRemove = "cohost_remove"
+	// Chat moderation, see room.chat.moderation.go
+	ActionChatDelete   = "chat_delete"
+	ActionChatSettings = "chat_settings"
+	// Stream keys, see room.ingress.controller.go
+	ActionIngressCreate = "ingress_create"
+	ActionIngressRotate = "ingress_rotate"
+)
+
+// BanEntry records who banned an identity from a room and why
+type BanEntry struct {
+	Identity string    `json:"identity"`
+	Reason   string    `json:"reason,omitempty"`
+	BannedBy string    `json:"bannedBy"`
+	BannedAt time.Time `json:"bannedAt"`
+}
+
+// AuditEntry is one moderation action in a room
+type AuditEntry struct {
+	Action    string      `json:"action"`
+	ActorID   string      `json:"actorId"`
+	ActorName string      `json:"actorName"`
+	Target    string      `json:"target"`
+	Details   interface{} `json:"details,omitempty"`
+	At        time.Time   `json:"at"`
+}
+
+func KickParticipant(c *fiber.Ctx, config *initializers.Config) error {
+	user, _, ok, err := moderatedParticipant(c)
+	if !ok {
+		return err
+	}
+	roomId, identity := c.Params("roomId"), c.Params("identity")
+
+	if err := LiveKit.RemoveParticipant(c.Context(), roomId, identity); err != nil {
+		return liveKitFailure(c, err)
+	}
+	audit(roomId, ActionKick, user, identity, nil, config)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   fiber.Map{"identity": identity},
+	})
+}
+
+func MuteParticipant(c *fiber.Ctx, config *initializers.Config) error {
+	// Without trackSid every track of the given sources is muted, without sources all tracks
+	type RequestData struct {
+		TrackSid string   `json:"trackSid"`
+		Sources  []string `json:"sources"`
+		Muted    *bool    `json:"muted"`
+	}
+
+	user, _, ok, err := moderatedParticipant(c)
+	if !ok {
+		return err
+	}
+	roomId, identity := c.Params("roomId"), c.Params("identity")
+
+	requestData := new(RequestData)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(requestData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to parse request body: %v", err),
+			})
+		}
+	}
+	muted := requestData.Muted == nil || *requestData.Muted
+
+	trackSids := []string{}
+	if requestData.TrackSid != "" {
+		trackSids = append(trackSids, requestData.TrackSid)
+	} else {
+		tracks, err := LiveKit.ParticipantTracks(c.Context(), roomId, identity)
+		if err != nil {
+			return liveKitFailure(c, err)
+		}
+		for _, track := range tracks {
+			if len(requestData.Sources) == 0 || contains(requestData.Sources, track.Source) {
+				trackSids = append(trackSids, track.Sid)
+			}
+		}
+	}
+
+	for _, trackSid := range trackSids {
+		if err := LiveKit.MutePublishedTrack(c.Context(), roomId, identity, trackSid, muted); err != nil {
+			return liveKitFailure(c, err)
+		}
+	}
+	audit(roomId, ActionMute, user, identity, fiber.Map{"tracks": trackSids, "muted": muted}, config)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   fiber.Map{"tracks": trackSids, "muted": muted},
+	})
+}
+
+// BanParticipant keeps an identity out of the room: it is kicked, refused tokens and kicked again when it
+// reconnects with a token issued before the ban, see onParticipantJoined. Guests can't be banned, every
+// guest join gets a new identity, they are kicked instead or the room stops allowing guests.
+func BanParticipant(c *fiber.Ctx, config *initializers.Config) error {
+	type RequestData struct {
+		Reason string `json:"reason"`
+	}
+
+	user, roomDetails, ok, err := moderatedParticipant(c)
+	if !ok {
+		return err
+	}
+	roomId, identity := c.Params("roomId"), c.Params("identity")
+
+	if utils.IsGuestIdentity(identity) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Guests can't be banned, they join with a new identity every time. Kick them or stop allowing guests",
+		})
+	}
+
+	requestData := new(RequestData)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(requestData); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to parse request body: %v", err),
+			})
+		}
+	}
+
+	ban := BanEntry{
+		Identity: identity,
+		Reason:   requestData.Reason,
+		BannedBy: user.ID,
+		BannedAt: time.Now(),
+	}
+	banJSON, err := json.Marshal(ban)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to encode ban",
+		})
+	}
+
+	// The ban list lives as long as the room
+	_, err = initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(initializers.Ctx, bansPrefix+roomId, identity, banJSON)
+		pipe.Expire(initializers.Ctx, bansPrefix+roomId, storedRoomTTL(roomDetails))
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to store ban",
+		})
+	}
+	audit(roomId, ActionBan, user, identity, fiber.Map{"reason": requestData.Reason}, config)
+
+	// A banned co-host leaves the stage with the room
+	if _, err := removeCoHost(c, roomId, identity); err != nil {
+		log.Printf("Failed to remove banned co-host %s from room %s: %v", identity, roomId, err)
+	}
+
+	// Banned participants which are connected are removed right away
+	if err := LiveKit.RemoveParticipant(c.Context(), roomId, identity); err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+		return liveKitFailure(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   ban,
+	})
+}
+
+func UnbanParticipant(c *fiber.Ctx, config *initializers.Config) error {
+	user, _, ok, err := moderatedParticipant(c)
+	if !ok {
+		return err
+	}
+	roomId, identity := c.Params("roomId"), c.Params("identity")
+
+	removed, err := initializers.RedisClient.HDel(initializers.Ctx, bansPrefix+roomId, identity).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to remove ban",
+		})
+	}
+	if removed == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Participant is not banned",
+		})
+	}
+	audit(roomId, ActionUnban, user, identity, nil, config)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+	})
+}
+
+func GetRoomBans(c *fiber.Ctx, config *initializers.Config) error {
+	_, _, ok, err := moderatedRoom(c)
+	if !ok {
+		return err
+	}
+
+	values, err := initializers.RedisClient.HVals(initializers.Ctx, bansPrefix+c.Params("roomId")).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching bans",
+		})
+	}
+
+	bans := make([]BanEntry, 0, len(values))
+	for _, value := range values {
+		var ban BanEntry
+		if err := json.Unmarshal([]byte(value), &ban); err == nil {
+			bans = append(bans, ban)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   bans,
+	})
+}
+
+func GetRoomAuditLog(c *fiber.Ctx, config *initializers.Config) error {
+	_, _, ok, err := moderatedRoom(c)
+	if !ok {
+		return err
+	}
+
+	limit := utils.ParseLimit(c.Query("limit"))
+	values, err := initializers.RedisClient.LRange(initializers.Ctx, auditPrefix+c.Params("roomId"), 0, int64(limit-1)).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching audit log",
+		})
+	}
+
+	entries := make([]AuditEntry, 0, len(values))
+	for _, value := range values {
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(value), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   entries,
+	})
+}
+
+// isBanned reports whether identity is on the ban list of a room
+func isBanned(roomId, identity string) (bool, error) {
+	if roomId == "" || identity == "" {
+		return false, nil
+	}
+	return initializers.RedisClient.HExists(initializers.Ctx, bansPrefix+roomId, identity).Result()
+}
+
+// canModerateRoom reports whether the user may act on participants of a room
+func canModerateRoom(user middleware.UserDetailsResponse, roomDetails *RoomDetails) bool {
+	return canManageRoom(user, roomDetails) || contains(roomDetails.Moderators, user.ID)
+}
+
+// moderatedRoom loads the room of the request and checks that the user moderates it.
+// When ok is false the error response has been written and err is to be returned.
+func moderatedRoom(c *fiber.Ctx) (user middleware.UserDetailsResponse, roomDetails *RoomDetails, ok bool, err error) {
+	user, ok = c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return user, nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	roomDetails, err = getRoomDetails(c.Params("roomId"))
+	if err == redis.Nil {
+		return user, nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return user, nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	if !canModerateRoom(user, roomDetails) {
+		return user, nil, false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not a moderator of this room",
+		})
+	}
+	return user, roomDetails, true, nil
+}
+
+// moderatedParticipant is moderatedRoom which also checks that the user may act on the participant
+// of the request. Nobody acts on the publisher, and only the owner or an admin on moderators.
+func moderatedParticipant(c *fiber.Ctx) (middleware.UserDetailsResponse, *RoomDetails, bool, error) {
+	user, roomDetails, ok, err := moderatedRoom(c)
+	if !ok {
+		return user, nil, false, err
+	}
+
+	identity := c.Params("identity")
+	if identity == user.ID {
+		return user, nil, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You can't moderate yourself",
+		})
+	}
+	if identity == roomDetails.Publisher.ID || (contains(roomDetails.Moderators, identity) && !canManageRoom(user, roomDetails)) {
+		return user, nil, false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You can't moderate this participant",
+		})
+	}
+	return user, roomDetails, true, nil
+}
+
+// audit appends a moderation action to the audit log of a room, which is kept as long as the room history
+func audit(roomId, action string, actor middleware.UserDetailsResponse, target string, details interface{}, config *initializers.Config) {
+	log.Printf("Moderation in room %s: %s %s by %s", roomId, action, target, actor.ID)
+
+	entryJSON, err := json.Marshal(AuditEntry{
+		Action:    action,
+		ActorID:   actor.ID,
+		ActorName: actor.Name,
+		Target:    target,
+		Details:   details,
+		At:        time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to encode audit entry of room %s: %v", roomId, err)
+		return
+	}
+
+	key := auditPrefix + roomId
+	_, err = initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(initializers.Ctx, key, entryJSON)
+		pipe.LTrim(initializers.Ctx, key, 0, maxAuditEntries-1)
+		pipe.Expire(initializers.Ctx, key, config.History.RetentionDuration())
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to write audit entry of room %s: %v", roomId, err)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
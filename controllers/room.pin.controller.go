@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"streaming/middleware"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// List of the pins and unpins of a room, newest first
+const pinHistoryPrefix = "pin_history:"
+
+// Entries kept per room in the pin history
+const maxPinHistory = 200
+
+var errProductNotInRoom = errors.New("product is not offered in this room")
+
+// PinnedProduct is the product currently highlighted in a live room
+type PinnedProduct struct {
+	ProductID string          `json:"productId"`
+	Product   json.RawMessage `json:"product"`
+	PinnedAt  time.Time       `json:"pinnedAt"`
+	PinnedBy  string          `json:"pinnedBy"`
+}
+
+// pinHistoryEntry is one line of the pin history, Action is EventProductPinned or EventProductUnpinned
+type pinHistoryEntry struct {
+	Action    string    `json:"action"`
+	ProductID string    `json:"productId"`
+	UserID    string    `json:"userId"`
+	At        time.Time `json:"at"`
+}
+
+func PinProduct(c *fiber.Ctx, config *initializers.Config) error {
+	type RequestData struct {
+		ProductId string `json:"productId"`
+	}
+
+	requestData := new(RequestData)
+	if err := c.BodyParser(requestData); err != nil || requestData.ProductId == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "productId is required",
+		})
+	}
+
+	return changePin(c, requestData.ProductId)
+}
+
+func UnpinProduct(c *fiber.Ctx, config *initializers.Config) error {
+	return changePin(c, "")
+}
+
+// changePin pins productId in the room of the request, or removes the pin when productId is empty
+func changePin(c *fiber.Ctx, productId string) error {
+	roomId := c.Params("roomId")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	if !canManageRoom(user, roomDetails) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not the owner of this room",
+		})
+	}
+	if roomStatus(roomDetails) != RoomLive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Room is %s", roomStatus(roomDetails)),
+		})
+	}
+
+	var pinned *PinnedProduct
+	updated, err := updateRoomDetails(c.Context(), roomId, func(roomDetails *RoomDetails) error {
+		if productId == "" {
+			roomDetails.Pinned = nil
+			return nil
+		}
+		product, ok := findProduct(roomDetails.Products, productId)
+		if !ok {
+			return errProductNotInRoom
+		}
+		pinned = &PinnedProduct{
+			ProductID: productId,
+			Product:   product,
+			PinnedAt:  time.Now(),
+			PinnedBy:  user.ID,
+		}
+		roomDetails.Pinned = pinned
+		return nil
+	})
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if errors.Is(err, errProductNotInRoom) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Product is not offered in this room",
+		})
+	} else if errors.Is(err, errRoomChanged) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room was changed meanwhile, try again",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to update pin: %v", err),
+		})
+	}
+
+	entry := pinHistoryEntry{Action: EventProductPinned, ProductID: productId, UserID: user.ID, At: time.Now()}
+	var event interface{} = pinned
+	if productId == "" {
+		entry.Action = EventProductUnpinned
+		if roomDetails.Pinned != nil {
+			entry.ProductID = roomDetails.Pinned.ProductID
+		}
+		event = fiber.Map{"productId": entry.ProductID}
+	}
+	if err := recordPin(roomId, entry); err != nil {
+		log.Printf("Failed to record pin history of room %s: %v", roomId, err)
+	}
+
+	// Participants which miss the message read the pin from GetTradingRoom
+	notified := true
+	if err := broadcastRoomEvent(c.Context(), roomId, entry.Action, event); err != nil {
+		notified = false
+		if !errors.Is(err, livekitapi.ErrNotFound) {
+			log.Printf("Failed to broadcast pin of room %s: %v", roomId, err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"pinned":   updated.Pinned,
+			"notified": notified,
+		},
+	})
+}
+
+// recordPin prepends an entry to the pin history of a room, which lives as long as the room
+func recordPin(roomId string, entry pinHistoryEntry) error {
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	key := pinHistoryPrefix + roomId
+	_, err = initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(initializers.Ctx, key, entryJSON)
+		pipe.LTrim(initializers.Ctx, key, 0, maxPinHistory-1)
+		pipe.Expire(initializers.Ctx, key, roomTTL)
+		return nil
+	})
+	return err
+}
+
+// findProduct looks up a product by ID in the stored products of a room
+func findProduct(products json.RawMessage, productId string) (json.RawMessage, bool) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(products, &items); err != nil {
+		return nil, false
+	}
+	for _, item := range items {
+		if productID(item) == productId {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+// productID returns the ID of a product as stored, the backend has used "id", "ID" and "_id",
+// with numbers or strings
+func productID(product json.RawMessage) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(product, &fields); err != nil {
+		return ""
+	}
+	for _, key := range []string{"id", "ID", "_id"} {
+		switch id := fields[key].(type) {
+		case string:
+			return id
+		case float64:
+			return strconv.FormatFloat(id, 'f', -1, 64)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"streaming/initializers"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Held by the replica currently sweeping, so replicas do not end the same room twice
+const reaperLockKey = "lock:room_reaper"
+
+// Lifetime of the lock, renewed before every room. Well above the time ending a single room takes
+// with backend retries, and only reached when the replica holding it died.
+const reaperLockTTL = 2 * time.Minute
+
+// Rooms loaded at once, a sweep pages through all candidates
+const reaperBatchSize = 500
+
+var errReaperLockLost = errors.New("reaper lock lost")
+
+// Deletes the lock only when it is still ours, it may have expired and been taken meanwhile
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Extends the lock only when it is still ours
+var extendLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// StartRoomReaper ends live rooms whose publisher is gone for longer than rooms.publisher_grace, and live
+// rooms about to expire, so their archive record gets the viewer stats before the live state is gone.
+// It runs until ctx is done, without a grace period only expiring rooms are ended.
+func StartRoomReaper(ctx context.Context, config *initializers.Config) {
+	grace := config.Rooms.PublisherGraceDuration()
+	interval := config.Rooms.ReaperIntervalDuration()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := reapStaleRooms(ctx, grace, interval, config); err != nil {
+					log.Printf("Room reaper failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// reapStaleRooms runs one sweep if no other replica holds the lock
+func reapStaleRooms(ctx context.Context, grace, interval time.Duration, config *initializers.Config) error {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	owner := hex.EncodeToString(token)
+
+	acquired, err := initializers.RedisClient.SetNX(ctx, reaperLockKey, owner, reaperLockTTL).Result()
+	if err != nil || !acquired {
+		return err
+	}
+	defer releaseLockScript.Run(ctx, initializers.RedisClient, []string{reaperLockKey}, owner)
+
+	// Rooms expiring before the sweep after next are ended by this one
+	now := time.Now()
+	expiryMargin := 2 * interval
+	staleCutoff := now.Add(-grace)
+
+	// Rooms live for less than the grace period are never stale, and a room can't expire
+	// before roomTTL passed since it was created
+	maxScore := now.Add(-roomTTL + expiryMargin)
+	if grace > 0 && staleCutoff.After(maxScore) {
+		maxScore = staleCutoff
+	}
+
+	// Ended rooms leave the registry, so the next page starts after the rooms which stayed.
+	// Rooms failing to end are skipped this way instead of blocking the ones behind them.
+	var offset int64
+	for {
+		roomIds, err := initializers.RedisClient.ZRangeByScore(ctx, activeRoomsKey, &redis.ZRangeBy{
+			Min:    "-inf",
+			Max:    strconv.FormatInt(maxScore.UnixMilli(), 10),
+			Offset: offset,
+			Count:  reaperBatchSize,
+		}).Result()
+		if err != nil {
+			return err
+		}
+
+		kept, err := reapRooms(ctx, owner, roomIds, grace, staleCutoff, expiryMargin, config)
+		if err != nil {
+			return err
+		}
+		offset += int64(kept)
+		if len(roomIds) < reaperBatchSize {
+			return nil
+		}
+	}
+}
+
+// reapRooms ends the stale and expiring rooms among roomIds and returns how many stayed registered
+func reapRooms(ctx context.Context, owner string, roomIds []string, grace time.Duration, staleCutoff time.Time, expiryMargin time.Duration, config *initializers.Config) (int, error) {
+	rooms, err := getRoomDetailsBatch(roomIds)
+	if err != nil {
+		return 0, err
+	}
+	// Without the live state every room would look stale, the sweep stops instead
+	states, err := loadLiveStates(roomIds)
+	if err != nil {
+		return 0, err
+	}
+	ttls := loadRoomTTLs(ctx, roomIds)
+
+	kept := 0
+	for _, roomId := range roomIds {
+		roomDetails, ok := rooms[roomId]
+		if !ok {
+			// Details expired, listActiveRooms prunes these as well
+			if err := initializers.RedisClient.ZRem(ctx, activeRoomsKey, roomId).Err(); err != nil {
+				kept++
+			}
+			continue
+		}
+		stale := grace > 0 && isStale(states[roomId], staleCutoff)
+		expiring := ttls[roomId] > 0 && ttls[roomId] < expiryMargin
+		if roomStatus(&roomDetails) != RoomLive || (!stale && !expiring) {
+			kept++
+			continue
+		}
+
+		// Ending a room may take a while, another replica must not take over meanwhile
+		extended, err := extendLockScript.Run(ctx, initializers.RedisClient, []string{reaperLockKey}, owner, reaperLockTTL.Milliseconds()).Int()
+		if err != nil {
+			return kept, err
+		}
+		if extended == 0 {
+			return kept, errReaperLockLost
+		}
+
+		if err := endRoom(ctx, roomId, &roomDetails, config); err != nil {
+			// Picked up again by the next sweep
+			log.Printf("Room reaper failed to end room %s: %v", roomId, err)
+			kept++
+			continue
+		}
+		if stale {
+			log.Printf("Room reaper ended room %s without publisher", roomId)
+		} else {
+			log.Printf("Room reaper ended expiring room %s", roomId)
+		}
+	}
+	return kept, nil
+}
+
+// loadRoomTTLs fetches the remaining lifetime of the given rooms, rooms without one are left out
+func loadRoomTTLs(ctx context.Context, roomIds []string) map[string]time.Duration {
+	ttls := make(map[string]time.Duration, len(roomIds))
+	cmds := make([]*redis.DurationCmd, len(roomIds))
+	_, err := initializers.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, roomId := range roomIds {
+			cmds[i] = pipe.PTTL(ctx, "room:"+roomId)
+		}
+		return nil
+	})
+	if err != nil {
+		return ttls
+	}
+	for i, cmd := range cmds {
+		if ttl := cmd.Val(); ttl > 0 {
+			ttls[roomIds[i]] = ttl
+		}
+	}
+	return ttls
+}
+
+// isStale reports whether a room neither publishes nor received a heartbeat since cutoff
+func isStale(state *LiveState, cutoff time.Time) bool {
+	if state == nil {
+		return true
+	}
+	if state.IsPublishing {
+		return false
+	}
+	return state.LastHeartbeat == nil || state.LastHeartbeat.Before(cutoff)
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"streaming/backend"
+	"streaming/initializers"
+	"streaming/middleware"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// liveRoom stores a live room created age ago which expires in ttl, with an archive draft
+func liveRoom(t *testing.T, roomId string, age, ttl time.Duration, publishing bool) {
+	t.Helper()
+	ctx := context.Background()
+	roomDetails := &RoomDetails{Publisher: middleware.UserDetailsResponse{ID: "owner"}, Title: roomId, Status: RoomLive}
+	roomDetailsJSON, _ := json.Marshal(roomDetails)
+	createdAt := time.Now().Add(-age)
+
+	_, err := initializers.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "room:"+roomId, roomDetailsJSON, ttl)
+		pipe.ZAdd(ctx, activeRoomsKey, redis.Z{Score: float64(createdAt.UnixMilli()), Member: roomId})
+		pipe.HSet(ctx, roomStatePrefix+roomId, "publishing", publishing, "peakViewers", 5)
+		pipe.PFAdd(ctx, roomViewersPrefix+roomId, "a", "b", "c")
+		return startArchive(pipe, roomId, roomDetails, createdAt, &initializers.Config{})
+	})
+	if err != nil {
+		t.Fatalf("storing room %s: %v", roomId, err)
+	}
+}
+
+func TestReapStaleRooms(t *testing.T) {
+	const interval = 30 * time.Second
+	tests := []struct {
+		name       string
+		grace      time.Duration
+		age        time.Duration
+		ttl        time.Duration
+		publishing bool
+		endErr     error
+		wantEnded  bool
+	}{
+		{name: "fresh room", grace: 2 * time.Minute, age: time.Minute, ttl: roomTTL},
+		{name: "publishing room", grace: 2 * time.Minute, age: time.Hour, ttl: roomTTL, publishing: true},
+		{name: "room without publisher", grace: 2 * time.Minute, age: time.Hour, ttl: roomTTL, wantEnded: true},
+		{name: "room without publisher and no grace", age: time.Hour, ttl: roomTTL},
+		{name: "expiring publishing room", grace: 2 * time.Minute, age: roomTTL, ttl: interval, publishing: true, wantEnded: true},
+		{name: "expiring room and no grace", age: roomTTL, ttl: interval, wantEnded: true},
+		{
+			name: "backend lost the stream", grace: 2 * time.Minute, age: time.Hour, ttl: roomTTL,
+			endErr:    &backend.Error{Op: "end streaming", Err: &backend.StatusError{StatusCode: 404}},
+			wantEnded: true,
+		},
+		{
+			name: "backend fails", grace: 2 * time.Minute, age: time.Hour, ttl: roomTTL,
+			endErr: &backend.Error{Op: "end streaming", Err: &backend.StatusError{StatusCode: 503}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, stub := setupServices(t)
+			stub.endErr = tt.endErr
+			liveRoom(t, "room", tt.age, tt.ttl, tt.publishing)
+
+			if err := reapStaleRooms(context.Background(), tt.grace, interval, &initializers.Config{}); err != nil {
+				t.Fatalf("reapStaleRooms() = %v", err)
+			}
+
+			if ended := !mr.Exists("room:room"); ended != tt.wantEnded {
+				t.Fatalf("room ended = %v, want %v", ended, tt.wantEnded)
+			}
+			if !tt.wantEnded {
+				return
+			}
+
+			// The archive keeps the stats of the live state the room was ended with
+			val, err := mr.Get(historyRoomPrefix + "room")
+			if err != nil {
+				t.Fatalf("archive record: %v", err)
+			}
+			var record ArchivedRoom
+			json.Unmarshal([]byte(val), &record)
+			if record.EndedAt == nil || record.PeakViewers != 5 || record.UniqueViewers != 3 {
+				t.Errorf("archive record = ended %v, peak %d, unique %d, want ended, 5 and 3", record.EndedAt, record.PeakViewers, record.UniqueViewers)
+			}
+			for _, key := range []string{roomStatePrefix + "room", roomViewersPrefix + "room"} {
+				if mr.Exists(key) {
+					t.Errorf("%s was left behind", key)
+				}
+			}
+		})
+	}
+}
+
+func TestReapStaleRoomsPagesPastKeptRooms(t *testing.T) {
+	mr, _ := setupServices(t)
+	// A full batch of older rooms which stay live comes first
+	for i := 0; i < reaperBatchSize; i++ {
+		liveRoom(t, fmt.Sprintf("live-%03d", i), 2*time.Hour, roomTTL, true)
+	}
+	liveRoom(t, "stale", time.Hour, roomTTL, false)
+
+	if err := reapStaleRooms(context.Background(), 2*time.Minute, 30*time.Second, &initializers.Config{}); err != nil {
+		t.Fatalf("reapStaleRooms() = %v", err)
+	}
+
+	if mr.Exists("room:stale") {
+		t.Error("stale room behind a full batch was not ended")
+	}
+	if !mr.Exists("room:live-000") {
+		t.Error("publishing room was ended")
+	}
+}
+
+func TestReapStaleRoomsSkipsWhileLocked(t *testing.T) {
+	mr, _ := setupServices(t)
+	liveRoom(t, "stale", time.Hour, roomTTL, false)
+	mr.Set(reaperLockKey, "other replica")
+
+	if err := reapStaleRooms(context.Background(), 2*time.Minute, 30*time.Second, &initializers.Config{}); err != nil {
+		t.Fatalf("reapStaleRooms() = %v", err)
+	}
+
+	if !mr.Exists("room:stale") {
+		t.Error("room was ended while another replica holds the lock")
+	}
+	if owner, _ := mr.Get(reaperLockKey); owner != "other replica" {
+		t.Errorf("lock = %q, want it left to the other replica", owner)
+	}
+}
+
+func TestReapStaleRoomsStopsWithoutLiveState(t *testing.T) {
+	mr, stub := setupServices(t)
+	liveRoom(t, "publishing", time.Hour, roomTTL, true)
+	liveRoom(t, "stale", time.Hour, roomTTL, false)
+	initializers.RedisClient.AddHook(failKeys{prefix: roomStatePrefix})
+
+	if err := reapStaleRooms(context.Background(), 2*time.Minute, 30*time.Second, &initializers.Config{}); !errors.Is(err, errInjected) {
+		t.Fatalf("reapStaleRooms() = %v, want the state loading error", err)
+	}
+
+	for _, roomId := range []string{"publishing", "stale"} {
+		if !mr.Exists("room:" + roomId) {
+			t.Errorf("room %s was ended without its live state", roomId)
+		}
+	}
+	if len(stub.ended) != 0 {
+		t.Errorf("backend streams ended = %q, want none", stub.ended)
+	}
+	if mr.Exists(reaperLockKey) {
+		t.Error("lock was not released")
+	}
+}
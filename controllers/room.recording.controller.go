@@ -0,0 +1,387 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"streaming/middleware"
+	"streaming/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Recording by egress ID
+	recordingPrefix = "recording:"
+	// Egress ID of the running recording of a room, one at a time
+	recordingActivePrefix = "recording_active:"
+	// Sorted sets of egress IDs scored by start time in milliseconds, per room and per publisher
+	recordingsRoomPrefix = "recordings:room:"
+	recordingsUserPrefix = "recordings:user:"
+)
+
+// Placeholder of the active recording while egress is being started
+const recordingPending = "pending"
+
+// Recording is a recording of a room together with the room it was made of
+type Recording struct {
+	livekitapi.Egress
+	PublisherID string `json:"publisherId"`
+	Title       string `json:"title"`
+	StartedBy   string `json:"startedBy"`
+}
+
+func StartRecording(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	if !canManageRoom(user, roomDetails) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not the owner of this room",
+		})
+	}
+	if roomStatus(roomDetails) != RoomLive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Room is %s", roomStatus(roomDetails)),
+		})
+	}
+
+	output, err := initializers.NewRecordingOutput(config)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Recording is not configured: %v", err),
+		})
+	}
+
+	// Claimed before egress is started, so two requests can't start two recordings
+	activeKey := recordingActivePrefix + roomId
+	claimed, err := initializers.RedisClient.SetNX(initializers.Ctx, activeKey, recordingPending, roomTTL).Result()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error checking active recording",
+		})
+	}
+	if !claimed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room is already being recorded",
+		})
+	}
+
+	egress, err := LiveKit.StartRoomRecording(c.Context(), roomId, output)
+	if err != nil {
+		initializers.RedisClient.Del(initializers.Ctx, activeKey)
+		if errors.Is(err, livekitapi.ErrNotFound) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Room has no participants to record",
+			})
+		}
+		return liveKitFailure(c, err)
+	}
+
+	recording := Recording{
+		Egress:      *egress,
+		PublisherID: roomDetails.Publisher.ID,
+		Title:       roomDetails.Title,
+		StartedBy:   user.ID,
+	}
+	if recording.StartedAt == nil {
+		now := time.Now()
+		recording.StartedAt = &now
+	}
+	err = storeRecording(&recording, config, func(pipe redis.Pipeliner) {
+		pipe.Set(initializers.Ctx, activeKey, egress.ID, roomTTL)
+		score := float64(recording.StartedAt.UnixMilli())
+		pipe.ZAdd(initializers.Ctx, recordingsRoomPrefix+roomId, redis.Z{Score: score, Member: egress.ID})
+		pipe.ZAdd(initializers.Ctx, recordingsUserPrefix+recording.PublisherID, redis.Z{Score: score, Member: egress.ID})
+		pipe.Expire(initializers.Ctx, recordingsRoomPrefix+roomId, config.History.RetentionDuration())
+		pipe.Expire(initializers.Ctx, recordingsUserPrefix+recording.PublisherID, config.History.RetentionDuration())
+	})
+	if err != nil {
+		// Egress runs anyway, stop it rather than leave a recording nobody knows about
+		LiveKit.StopEgress(initializers.Ctx, egress.ID)
+		initializers.RedisClient.Del(initializers.Ctx, activeKey)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to store recording",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   recording,
+	})
+}
+
+func StopRecording(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	if !canManageRoom(user, roomDetails) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not the owner of this room",
+		})
+	}
+
+	activeKey := recordingActivePrefix + roomId
+	egressId, err := initializers.RedisClient.Get(initializers.Ctx, activeKey).Result()
+	if err == redis.Nil || egressId == recordingPending {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room is not being recorded",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching active recording",
+		})
+	}
+
+	egress, err := LiveKit.StopEgress(c.Context(), egressId)
+	if err != nil && !errors.Is(err, livekitapi.ErrNotFound) {
+		return liveKitFailure(c, err)
+	}
+
+	// The files are final with the egress_ended webhook, a new recording may start right away
+	initializers.RedisClient.Del(initializers.Ctx, activeKey)
+	var recording *Recording
+	if egress != nil {
+		recording, err = updateRecording(egress, config)
+		if err != nil {
+			log.Printf("Failed to update recording %s: %v", egressId, err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   recording,
+	})
+}
+
+// GetRecordings lists finished recordings newest first, of a room with ?roomId= or of the caller
+func GetRecordings(c *fiber.Ctx, config *initializers.Config) error {
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	cursor, err := utils.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid cursor",
+		})
+	}
+	limit := utils.ParseLimit(c.Query("limit"))
+
+	key := recordingsUserPrefix + user.ID
+	if roomId := c.Query("roomId"); roomId != "" {
+		// Recordings outlive their room, once it expired only the ownership of each recording is checked
+		roomDetails, err := getRoomDetails(roomId)
+		if err != nil && err != redis.Nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error fetching room details",
+			})
+		}
+		if err == nil && !canManageRoom(user, roomDetails) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "error",
+				"message": "You are not the owner of this room",
+			})
+		}
+		key = recordingsRoomPrefix + roomId
+	}
+
+	// Recordings belong to the publisher of the room, admins see all of them. Filtered out
+	// recordings would leave the page short, so pages are read until the limit is filled.
+	finished := []Recording{}
+	var next *utils.Cursor
+	for len(finished) < limit {
+		var egressIds []string
+		egressIds, next, err = pageSortedSet(key, cursor, limit-len(finished))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error fetching recordings",
+			})
+		}
+
+		recordings, err := getRecordings(egressIds)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error fetching recordings",
+			})
+		}
+		for _, recording := range recordings {
+			if recording.Finished() && (recording.PublisherID == user.ID || user.IsAdmin()) {
+				finished = append(finished, recording)
+			}
+		}
+
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+
+	nextCursor := ""
+	if next != nil {
+		nextCursor = next.Encode()
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   finished,
+		"meta": fiber.Map{
+			"limit":      limit,
+			"nextCursor": nextCursor,
+		},
+	})
+}
+
+// onEgressUpdated applies egress webhooks to the stored recording
+func onEgressUpdated(egress *livekitapi.Egress, config *initializers.Config) error {
+	if _, err := updateRecording(egress, config); err != nil && err != redis.Nil {
+		return err
+	}
+	if !egress.Finished() {
+		return nil
+	}
+
+	// Only clears the active recording when it is still this one
+	activeKey := recordingActivePrefix + egress.RoomID
+	active, err := initializers.RedisClient.Get(initializers.Ctx, activeKey).Result()
+	if err == nil && active == egress.ID {
+		return initializers.RedisClient.Del(initializers.Ctx, activeKey).Err()
+	} else if err != redis.Nil {
+		return err
+	}
+	return nil
+}
+
+// updateRecording merges the egress state into the stored recording, returns redis.Nil for unknown egresses
+func updateRecording(egress *livekitapi.Egress, config *initializers.Config) (*Recording, error) {
+	val, err := initializers.RedisClient.Get(initializers.Ctx, recordingPrefix+egress.ID).Result()
+	if err != nil {
+		return nil, err
+	}
+	var recording Recording
+	if err := json.Unmarshal([]byte(val), &recording); err != nil {
+		return nil, err
+	}
+
+	// Webhooks may arrive out of order, a finished recording stays finished
+	if recording.Finished() && !egress.Finished() {
+		return &recording, nil
+	}
+	startedAt := recording.StartedAt
+	recording.Egress = *egress
+	if recording.StartedAt == nil {
+		recording.StartedAt = startedAt
+	}
+
+	return &recording, storeRecording(&recording, config, nil)
+}
+
+// storeRecording writes a recording, kept as long as the room history, with extra commands in the same transaction
+func storeRecording(recording *Recording, config *initializers.Config, extra func(pipe redis.Pipeliner)) error {
+	recordingJSON, err := json.Marshal(recording)
+	if err != nil {
+		return err
+	}
+	_, err = initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(initializers.Ctx, recordingPrefix+recording.ID, recordingJSON, config.History.RetentionDuration())
+		if extra != nil {
+			extra(pipe)
+		}
+		return nil
+	})
+	return err
+}
+
+// getRecordings loads recordings in the given order, expired ones are skipped
+func getRecordings(egressIds []string) ([]Recording, error) {
+	recordings := []Recording{}
+	if len(egressIds) == 0 {
+		return recordings, nil
+	}
+
+	keys := make([]string, len(egressIds))
+	for i, egressId := range egressIds {
+		keys[i] = recordingPrefix + egressId
+	}
+	values, err := initializers.RedisClient.MGet(initializers.Ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range values {
+		val, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var recording Recording
+		if err := json.Unmarshal([]byte(val), &recording); err != nil {
+			continue
+		}
+		recordings = append(recordings, recording)
+	}
+	return recordings, nil
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"streaming/initializers"
+	"streaming/livekitapi"
+	"streaming/middleware"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// storeRecordings indexes recordings of the room, newest first
+func storeRecordings(t *testing.T, roomId string, recordings ...Recording) {
+	t.Helper()
+	for i, recording := range recordings {
+		recordingJSON, _ := json.Marshal(recording)
+		score := float64(len(recordings) - i)
+		err := initializers.RedisClient.Set(initializers.Ctx, recordingPrefix+recording.ID, recordingJSON, 0).Err()
+		if err == nil {
+			err = initializers.RedisClient.ZAdd(initializers.Ctx, recordingsRoomPrefix+roomId, redis.Z{Score: score, Member: recording.ID}).Err()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetRecordingsOfRoom(t *testing.T) {
+	recording := func(id, publisherId, status string) Recording {
+		return Recording{Egress: livekitapi.Egress{ID: id, RoomID: "room", Status: status}, PublisherID: publisherId}
+	}
+
+	tests := []struct {
+		name        string
+		user        middleware.UserDetailsResponse
+		roomExpired bool
+		want        int
+		wantPages   [][]string
+	}{
+		{name: "owner", user: middleware.UserDetailsResponse{ID: "owner"}, want: fiber.StatusOK, wantPages: [][]string{{"e1", "e3"}, {"e5"}}},
+		{name: "admin", user: middleware.UserDetailsResponse{ID: "admin", Role: middleware.RoleAdmin}, want: fiber.StatusOK, wantPages: [][]string{{"e1", "e3"}, {"e4", "e5"}}},
+		{name: "viewer", user: middleware.UserDetailsResponse{ID: "viewer"}, want: fiber.StatusForbidden},
+		{name: "owner of an expired room", user: middleware.UserDetailsResponse{ID: "owner"}, roomExpired: true, want: fiber.StatusOK, wantPages: [][]string{{"e1", "e3"}, {"e5"}}},
+		{name: "viewer of an expired room", user: middleware.UserDetailsResponse{ID: "viewer"}, roomExpired: true, want: fiber.StatusOK, wantPages: [][]string{{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupServices(t)
+			if !tt.roomExpired {
+				storeRoom(t, "room", &RoomDetails{Publisher: middleware.UserDetailsResponse{ID: "owner"}, Status: RoomLive})
+			}
+			storeRecordings(t, "room",
+				recording("e1", "owner", "complete"),
+				recording("e2", "owner", "active"),
+				recording("e3", "owner", "failed"),
+				recording("e4", "previous-owner", "complete"),
+				recording("e5", "owner", "complete"),
+			)
+
+			app := fiber.New()
+			app.Get("/recordings", func(c *fiber.Ctx) error {
+				c.Locals("userDetails", tt.user)
+				return GetRecordings(c, &initializers.Config{})
+			})
+
+			var pages [][]string
+			cursor := ""
+			for len(pages) <= len(tt.wantPages) {
+				res, err := app.Test(httptest.NewRequest("GET", "/recordings?roomId=room&limit=2&cursor="+cursor, nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.StatusCode != tt.want {
+					t.Fatalf("status %d, want %d", res.StatusCode, tt.want)
+				}
+				if tt.want != fiber.StatusOK {
+					return
+				}
+
+				var body struct {
+					Data []Recording `json:"data"`
+					Meta struct {
+						NextCursor string `json:"nextCursor"`
+					} `json:"meta"`
+				}
+				if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+				page := []string{}
+				for _, recording := range body.Data {
+					page = append(page, recording.ID)
+				}
+				pages = append(pages, page)
+				if cursor = body.Meta.NextCursor; cursor == "" {
+					break
+				}
+			}
+
+			if !reflect.DeepEqual(pages, tt.wantPages) {
+				t.Errorf("pages = %q, want %q", pages, tt.wantPages)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"streaming/initializers"
+	"streaming/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sorted set of active room IDs scored by creation time in milliseconds
+const activeRoomsKey = "rooms:active"
+
+// registerRoom adds the room to the active room registry
+func registerRoom(pipe redis.Pipeliner, roomId string, createdAt int64) {
+	pipe.ZAdd(initializers.Ctx, activeRoomsKey, redis.Z{
+		Score:  float64(createdAt),
+		Member: roomId,
+	})
+}
+
+// unregisterRoom removes the room from the active room registry
+func unregisterRoom(pipe redis.Pipeliner, roomId string) {
+	pipe.ZRem(initializers.Ctx, activeRoomsKey, roomId)
+}
+
+// listActiveRooms returns a page of active rooms, newest first, and the cursor of the next page
+func listActiveRooms(cursor *utils.Cursor, limit int) ([]string, map[string]RoomDetails, *utils.Cursor, error) {
+	roomIds, next, err := pageSortedSet(activeRoomsKey, cursor, limit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rooms, err := getRoomDetailsBatch(roomIds)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Rooms whose details expired are dropped from the page and from the registry
+	var stale []interface{}
+	order := make([]string, 0, len(roomIds))
+	for _, roomId := range roomIds {
+		if _, ok := rooms[roomId]; ok {
+			order = append(order, roomId)
+		} else {
+			stale = append(stale, roomId)
+		}
+	}
+	if len(stale) > 0 {
+		initializers.RedisClient.ZRem(initializers.Ctx, activeRoomsKey, stale...)
+	}
+
+	return order, rooms, next, nil
+}
+
+// getRoomDetailsBatch loads the details of many rooms with a single MGET, missing rooms are skipped
+func getRoomDetailsBatch(roomIds []string) (map[string]RoomDetails, error) {
+	rooms := make(map[string]RoomDetails, len(roomIds))
+	if len(roomIds) == 0 {
+		return rooms, nil
+	}
+
+	keys := make([]string, len(roomIds))
+	for i, roomId := range roomIds {
+		keys[i] = "room:" + roomId
+	}
+
+	values, err := initializers.RedisClient.MGet(initializers.Ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		val, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var roomDetails RoomDetails
+		if err := json.Unmarshal([]byte(val), &roomDetails); err != nil {
+			continue // Optionally log this error
+		}
+		rooms[roomIds[i]] = roomDetails
+	}
+	return rooms, nil
+}
+
+// pageSortedSet reads a page of members from a sorted set in descending score order
+func pageSortedSet(key string, cursor *utils.Cursor, limit int) ([]string, *utils.Cursor, error) {
+	return pageScoreRange(key, math.Inf(-1), cursor, limit, false)
+}
+
+// pageSortedSetFrom reads a page of members scored at least min in ascending score order
+func pageSortedSetFrom(key string, min float64, cursor *utils.Cursor, limit int) ([]string, *utils.Cursor, error) {
+	return pageScoreRange(key, min, cursor, limit, true)
+}
+
+func pageScoreRange(key string, min float64, cursor *utils.Cursor, limit int, ascending bool) ([]string, *utils.Cursor, error) {
+	rangeBy := &redis.ZRangeBy{Min: formatScore(min), Max: "+inf", Count: int64(limit + 1)}
+	if cursor != nil {
+		if !ascending {
+			rangeBy.Max = formatScore(cursor.Score)
+		} else if cursor.Score > min {
+			rangeBy.Min = formatScore(cursor.Score)
+		}
+	}
+
+	// Members sharing the cursor score are filtered out, so keep reading until the page is full
+	var page []redis.Z
+	for len(page) <= limit {
+		var batch []redis.Z
+		var err error
+		if ascending {
+			batch, err = initializers.RedisClient.ZRangeByScoreWithScores(initializers.Ctx, key, rangeBy).Result()
+		} else {
+			batch, err = initializers.RedisClient.ZRevRangeByScoreWithScores(initializers.Ctx, key, rangeBy).Result()
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		rangeBy.Offset += int64(len(batch))
+
+		for _, z := range batch {
+			member := z.Member.(string)
+			if cursor == nil || (!ascending && cursor.After(z.Score, member)) || (ascending && cursor.AfterAscending(z.Score, member)) {
+				page = append(page, z)
+			}
+		}
+	}
+
+	var next *utils.Cursor
+	if len(page) > limit {
+		page = page[:limit]
+		last := page[len(page)-1]
+		next = &utils.Cursor{Score: last.Score, Member: last.Member.(string)}
+	}
+
+	members := make([]string, 0, len(page))
+	for _, z := range page {
+		members = append(members, z.Member.(string))
+	}
+	return members, next, nil
+}
+
+// formatScore writes a score bound the way ZRANGEBYSCORE expects it
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "+inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
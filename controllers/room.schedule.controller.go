@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"streaming/initializers"
+	"streaming/middleware"
+	"streaming/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func ScheduleTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
+
+	type RequestData struct {
+		Products    []string  `json:"products"`
+		Title       string    `json:"title"`
+		CoverImage  string    `json:"coverImage"`
+		StartAt     time.Time `json:"startAt"`
+		AllowGuests bool      `json:"allowGuests"`
+		Moderators  []string  `json:"moderators"`
+	}
+
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	requestData := new(RequestData)
+	if err := c.BodyParser(requestData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to parse request body: %v", err),
+		})
+	}
+
+	if requestData.Title == "" || !requestData.StartAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "A title and a start time in the future are required",
+		})
+	}
+
+	fetchedProducts, err := Products.FetchProducts(c.Context(), requestData.Products, user.ID)
+	if err != nil {
+		return backendFailure(c, err)
+	}
+
+	roomId, err := utils.NewRoomID()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to generate room ID",
+		})
+	}
+	slug, err := reserveSlug(roomId, time.Until(requestData.StartAt)+roomTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to reserve room link",
+		})
+	}
+
+	startAt := requestData.StartAt
+	roomDetails := RoomDetails{
+		Products:    fetchedProducts,
+		Publisher:   user,
+		Title:       requestData.Title,
+		Slug:        slug,
+		Status:      RoomScheduled,
+		StartAt:     &startAt,
+		CoverImage:  requestData.CoverImage,
+		AllowGuests: requestData.AllowGuests,
+		Moderators:  requestData.Moderators,
+	}
+	if err := storeScheduledRoom(roomId, &roomDetails); err != nil {
+		initializers.RedisClient.Del(initializers.Ctx, slugPrefix+slug)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to store scheduled room",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"roomId": roomId,
+			"slug":   slug,
+			"room":   roomDetails,
+		},
+	})
+}
+
+func CancelScheduledRoom(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Server error while retrieving user details",
+		})
+	}
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+
+	if !canManageRoom(user, roomDetails) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not the owner of this room",
+		})
+	}
+	if !canTransition(roomStatus(roomDetails), RoomCancelled) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Room can't be cancelled from status %s", roomStatus(roomDetails)),
+		})
+	}
+
+	// The cancelled room stays readable until its TTL, so share links can tell viewers about it
+	roomDetails.Status = RoomCancelled
+	if err := storeScheduledRoom(roomId, roomDetails); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to cancel scheduled room",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+	})
+}
+
+// GetUpcomingRooms lists scheduled rooms by start time, it serves GetRooms with status=upcoming
+func GetUpcomingRooms(c *fiber.Ctx, config *initializers.Config) error {
+	cursor, err := utils.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid cursor",
+		})
+	}
+	limit := utils.ParseLimit(c.Query("limit"))
+	now := time.Now()
+
+	roomIds, next, err := pageSortedSetFrom(scheduledRoomsKey, float64(now.UnixMilli()), cursor, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching rooms",
+		})
+	}
+
+	rooms, err := getRoomDetailsBatch(roomIds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching rooms",
+		})
+	}
+
+	order := make([]string, 0, len(roomIds))
+	for _, roomId := range roomIds {
+		if _, ok := rooms[roomId]; ok {
+			order = append(order, roomId)
+		}
+	}
+
+	// Announcements whose start passed without going live are dropped from the schedule
+	initializers.RedisClient.ZRemRangeByScore(initializers.Ctx, scheduledRoomsKey, "-inf", strconv.FormatInt(now.Add(-roomTTL).UnixMilli(), 10))
+
+	nextCursor := ""
+	if next != nil {
+		nextCursor = next.Encode()
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"rooms":  rooms,
+		"order":  order,
+		"meta": fiber.Map{
+			"limit":      limit,
+			"nextCursor": nextCursor,
+		},
+		// Lets clients run the countdown against the server clock
+		"serverTime": now,
+	})
+}
+
+// reserveSlug allocates a free share link slug for the room
+func reserveSlug(roomId string, ttl time.Duration) (string, error) {
+	for attempt := 0; attempt < maxSlugAttempts; attempt++ {
+		slug, err := utils.NewSlug()
+		if err != nil {
+			return "", err
+		}
+		reserved, err := initializers.RedisClient.SetNX(initializers.Ctx, slugPrefix+slug, roomId, ttl).Result()
+		if err != nil {
+			return "", err
+		}
+		if reserved {
+			return slug, nil
+		}
+	}
+	return "", fmt.Errorf("no free slug found")
+}
+
+// storeScheduledRoom writes a scheduled or cancelled room and keeps the schedule in sync
+func storeScheduledRoom(roomId string, roomDetails *RoomDetails) error {
+	roomDetailsJSON, err := json.Marshal(roomDetails)
+	if err != nil {
+		return err
+	}
+
+	_, err = initializers.RedisClient.TxPipelined(initializers.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(initializers.Ctx, "room:"+roomId, roomDetailsJSON, storedRoomTTL(roomDetails))
+		if roomStatus(roomDetails) == RoomScheduled {
+			pipe.ZAdd(initializers.Ctx, scheduledRoomsKey, redis.Z{
+				Score:  float64(roomDetails.StartAt.UnixMilli()),
+				Member: roomId,
+			})
+		} else {
+			pipe.ZRem(initializers.Ctx, scheduledRoomsKey, roomId)
+		}
+		return nil
+	})
+	return err
+}
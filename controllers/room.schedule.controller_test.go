@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"streaming/initializers"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGetUpcomingRoomsPaging(t *testing.T) {
+	setupServices(t)
+	startAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	rooms := []struct {
+		roomId  string
+		startAt time.Time
+	}{
+		{"past", startAt.Add(-2 * time.Hour)},
+		{"first", startAt},
+		{"tie-b", startAt.Add(time.Minute)},
+		{"tie-a", startAt.Add(time.Minute)},
+		{"last", startAt.Add(time.Hour)},
+	}
+	for _, room := range rooms {
+		roomDetails := &RoomDetails{Title: room.roomId, Status: RoomScheduled, StartAt: &room.startAt}
+		if err := storeScheduledRoom(room.roomId, roomDetails); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := fiber.New()
+	app.Get("/rooms", func(c *fiber.Ctx) error {
+		return GetUpcomingRooms(c, &initializers.Config{})
+	})
+
+	var order []string
+	var pages int
+	cursor := ""
+	for {
+		res, err := app.Test(httptest.NewRequest("GET", "/rooms?limit=2&cursor="+cursor, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != fiber.StatusOK {
+			t.Fatalf("status %d on page %d", res.StatusCode, pages+1)
+		}
+		var body struct {
+			Order []string `json:"order"`
+			Meta  struct {
+				NextCursor string `json:"nextCursor"`
+			} `json:"meta"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, body.Order...)
+		pages++
+		if cursor = body.Meta.NextCursor; cursor == "" || pages > len(rooms) {
+			break
+		}
+	}
+
+	if want := []string{"first", "tie-a", "tie-b", "last"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %q, want %q", order, want)
+	}
+	if pages != 2 {
+		t.Errorf("read %d pages, want 2", pages)
+	}
+
+	res, err := app.Test(httptest.NewRequest("GET", "/rooms?cursor=not-a-cursor", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("invalid cursor status %d, want %d", res.StatusCode, fiber.StatusBadRequest)
+	}
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"encoding/json"
+	"streaming/initializers"
+	"streaming/search"
+	"streaming/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RoomSearchResult struct {
+	RoomID string      `json:"roomId"`
+	Score  float64     `json:"score"`
+	Room   RoomDetails `json:"room"`
+}
+
+func SearchTradingRooms(c *fiber.Ctx, config *initializers.Config) error {
+	query := c.Query("q")
+	limit := utils.ParseLimit(c.Query("limit"))
+
+	matches, err := RoomSearch.Search(initializers.Ctx, query, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error searching rooms",
+		})
+	}
+
+	roomIds := make([]string, len(matches))
+	for i, match := range matches {
+		roomIds[i] = match.RoomID
+	}
+	rooms, err := getRoomDetailsBatch(roomIds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching rooms",
+		})
+	}
+	attachLiveStates(rooms)
+
+	results := make([]RoomSearchResult, 0, len(matches))
+	for _, match := range matches {
+		roomDetails, ok := rooms[match.RoomID]
+		if !ok {
+			// The room expired without being removed from the index
+			RoomSearch.Remove(initializers.Ctx, match.RoomID)
+			continue
+		}
+		results = append(results, RoomSearchResult{RoomID: match.RoomID, Score: match.Score, Room: roomDetails})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data":   results,
+	})
+}
+
+// searchDocument collects the searchable text of a room
+func searchDocument(roomDetails RoomDetails) search.Document {
+	doc := search.Document{
+		Title:     roomDetails.Title,
+		Publisher: roomDetails.Publisher.Name,
+	}
+
+	// Products are stored as returned by the backend, only their names are needed here
+	var products []struct {
+		Title string `json:"title"`
+		Name  string `json:"name"`
+	}
+	if err := json.Unmarshal(roomDetails.Products, &products); err == nil {
+		for _, product := range products {
+			if product.Title != "" {
+				doc.Products = append(doc.Products, product.Title)
+			}
+			if product.Name != "" {
+				doc.Products = append(doc.Products, product.Name)
+			}
+		}
+	}
+	return doc
+}
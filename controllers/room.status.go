@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"streaming/backend"
+	"streaming/initializers"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Lifecycle of a room: scheduled → live → ended, a scheduled room may be cancelled instead
+const (
+	RoomScheduled = "scheduled"
+	RoomLive      = "live"
+	RoomEnded     = "ended"
+	RoomCancelled = "cancelled"
+)
+
+// Sorted set of scheduled room IDs scored by their start time in milliseconds
+const scheduledRoomsKey = "rooms:scheduled"
+
+// How long a room is kept after it went live, or after its announced start
+const roomTTL = 12 * time.Hour
+
+var roomTransitions = map[string][]string{
+	RoomScheduled: {RoomLive, RoomCancelled},
+	// Creating an own live room again refreshes it
+	RoomLive: {RoomLive, RoomEnded},
+}
+
+// roomStatus returns the status of a room, rooms stored before statuses existed are live
+func roomStatus(roomDetails *RoomDetails) string {
+	if roomDetails.Status == "" {
+		return RoomLive
+	}
+	return roomDetails.Status
+}
+
+// canTransition reports whether a room in status from may move to status to
+func canTransition(from, to string) bool {
+	for _, allowed := range roomTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// storedRoomTTL returns the TTL a room is stored with in its current status
+func storedRoomTTL(roomDetails *RoomDetails) time.Duration {
+	if roomStatus(roomDetails) == RoomScheduled && roomDetails.StartAt != nil {
+		return time.Until(*roomDetails.StartAt) + roomTTL
+	}
+	return roomTTL
+}
+
+// restoreRoom puts back the room details a failed create overwrote, or removes the room when there were none
+func restoreRoom(pipe redis.Pipeliner, roomId, previous string) {
+	if previous == "" {
+		pipe.Del(initializers.Ctx, "room:"+roomId)
+		unregisterRoom(pipe, roomId)
+		return
+	}
+
+	var roomDetails RoomDetails
+	if err := json.Unmarshal([]byte(previous), &roomDetails); err != nil {
+		pipe.Del(initializers.Ctx, "room:"+roomId)
+		unregisterRoom(pipe, roomId)
+		return
+	}
+
+	pipe.Set(initializers.Ctx, "room:"+roomId, previous, storedRoomTTL(&roomDetails))
+	if roomStatus(&roomDetails) == RoomScheduled {
+		unregisterRoom(pipe, roomId)
+		pipe.ZAdd(initializers.Ctx, scheduledRoomsKey, redis.Z{
+			Score:  float64(roomDetails.StartAt.UnixMilli()),
+			Member: roomId,
+		})
+	}
+}
+
+// endRoom deletes the ingress of a room, tells the backend that a live room ended, archives it and removes it with its live state.
+// DeleteTradingRoom, the room_finished webhook and the reaper all end rooms through here.
+func endRoom(ctx context.Context, roomId string, roomDetails *RoomDetails, config *initializers.Config) error {
+	// First, so the room stays and ending it can be retried while its stream key still works
+	if err := deleteRoomIngress(ctx, roomDetails); err != nil {
+		return err
+	}
+
+	// The backend record belongs to the publisher even when an admin ends the room,
+	// rooms which never went live have no record
+	if roomStatus(roomDetails) == RoomLive {
+		// A record which is gone already was ended before or never stored, the room still has to go
+		if err := Backend.EndStreaming(ctx, roomId, roomDetails.Publisher.ID, time.Now()); err != nil && !backend.IsNotFound(err) {
+			return err
+		}
+		// Needs the room state, so before it is deleted. The room is gone either way,
+		// a missing archive record is not worth failing for
+		if err := finishArchive(roomId, roomDetails, config); err != nil {
+			log.Printf("Failed to archive room %s: %v", roomId, err)
+		}
+	}
+
+	_, err := initializers.RedisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		// A running egress ends with the LiveKit room, its webhook still finalizes the recording
+		pipe.Del(ctx, "room:"+roomId, roomStatePrefix+roomId, roomPresentPrefix+roomId, roomViewersPrefix+roomId, bansPrefix+roomId, chatSettingsPrefix+roomId, recordingActivePrefix+roomId)
+		if roomDetails.Slug != "" {
+			pipe.Del(ctx, slugPrefix+roomDetails.Slug)
+		}
+		unregisterRoom(pipe, roomId)
+		pipe.ZRem(ctx, scheduledRoomsKey, roomId)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return RoomSearch.Remove(ctx, roomId)
+}
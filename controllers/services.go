@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"errors"
+	"streaming/backend"
+	"streaming/catalog"
+	"streaming/chatfilter"
+	"streaming/livekitapi"
+	"streaming/search"
+	"streaming/subscriptions"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Dependencies shared by the controllers, wired up in cmd/server/main.go and replaceable in tests
+var (
+	RoomSearch    search.Index = search.NewMemoryIndex()
+	Backend       backend.Client
+	Products      catalog.ProductCatalog
+	LiveKit       livekitapi.Client
+	ChatFilter    chatfilter.Filter     = chatfilter.Chain{}
+	Subscriptions subscriptions.Checker = subscriptions.Disabled{}
+)
+
+// backendFailure answers with 502 or 504 depending on how the backend call failed
+func backendFailure(c *fiber.Ctx, err error) error {
+	return c.Status(backend.HTTPStatus(err)).JSON(fiber.Map{
+		"status":  "error",
+		"message": err.Error(),
+	})
+}
+
+// liveKitFailure answers with 404 when LiveKit does not know the room or participant, otherwise 502
+func liveKitFailure(c *fiber.Ctx, err error) error {
+	if errors.Is(err, livekitapi.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Participant is not connected",
+		})
+	}
+	return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		"status":  "error",
+		"message": err.Error(),
+	})
+}
@@ -1,12 +1,13 @@
 package controllers
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"log"
 	"net/url"
+	"streaming/backend"
+	"streaming/catalog"
 	"streaming/initializers"
 	"streaming/middleware"
 	"streaming/utils"
@@ -22,22 +23,34 @@ type RoomDetails struct {
 	Products  json.RawMessage                `json:"products"`
 	Publisher middleware.UserDetailsResponse `json:"publisher"`
 	Title     string                         `json:"title"`
-}
-
-type Streaming struct {
-	Title     string    `json:"title"`
-	RoomID    string    `json:"roomId"`
-	UserID    string    `json:"userId"`
-	CreatedAt time.Time `json:"time"`
+	// Short ID of the share link /streaming/r/:slug
+	Slug string `json:"slug,omitempty"`
+	// One of RoomScheduled, RoomLive, RoomEnded or RoomCancelled
+	Status     string     `json:"status,omitempty"`
+	StartAt    *time.Time `json:"startAt,omitempty"`
+	CoverImage string     `json:"coverImage,omitempty"`
+	// Whether unauthenticated viewers may join with a generated guest identity
+	AllowGuests bool `json:"allowGuests"`
+	// Identities which join the room with the moderator grant profile
+	Moderators []string `json:"moderators,omitempty"`
+	// Identities on stage with the co-host grant profile, see AcceptCoHostInvite
+	CoHosts []string `json:"coHosts,omitempty"`
+	// Product highlighted by the publisher, see PinProduct
+	Pinned *PinnedProduct `json:"pinned,omitempty"`
+	// RTMP or WHIP endpoint for publishing from an encoder, see CreateRoomIngress
+	Ingress *RoomIngress `json:"ingress,omitempty"`
+	Live    *LiveState   `json:"live,omitempty"` // Filled on read, never stored
 }
 
 func CreateTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 
 	// Define the struct to get livekit Token
 	type RequestData struct {
-		RoomId   string   `json:"roomId"`
-		Products []string `json:"products"`
-		Title    string   `json:"title"`
+		RoomId      string   `json:"roomId"`
+		Products    []string `json:"products"`
+		Title       string   `json:"title"`
+		AllowGuests bool     `json:"allowGuests"`
+		Moderators  []string `json:"moderators"`
 	}
 
 	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
@@ -59,34 +72,92 @@ func CreateTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 		})
 	}
 
-	// ** Here Fetch data from backend with requestData.Products and store Products **
-	// Use the new function to fetch product details
-	fetchedProducts, err := fetchProductDetailsFromBackend(requestData.Products, user.ID)
-	if err != nil {
-		// Handle error
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	// A room ID can't be taken over from another publisher, storing the room checks this again atomically
+	roomId := requestData.RoomId
+	var existing, scheduled *RoomDetails
+	if roomId != "" {
+		var err error
+		existing, err = getRoomDetails(roomId)
+		if err != nil && err != redis.Nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Error fetching room details",
+			})
+		}
+		if existing != nil && existing.Publisher.ID != user.ID {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Room is already owned by another publisher",
+			})
+		}
+		if existing != nil && !canTransition(roomStatus(existing), RoomLive) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("Room can't go live from status %s", roomStatus(existing)),
+			})
+		}
+		if existing != nil && roomStatus(existing) == RoomScheduled {
+			// Going live on a scheduled room promotes it instead of creating a new one
+			scheduled = existing
+		}
+	}
+
+	// Room IDs are generated here, clients may only pick their own while rooms.allow_client_ids is set
+	if scheduled == nil && (roomId == "" || !config.Rooms.AllowClientIds) {
+		var err error
+		if roomId, err = utils.NewRoomID(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to generate room ID",
+			})
+		}
+	}
+
+	// Creating a live room again would register a second backend record and drop the slug,
+	// co-hosts, pin and archive of the running room, the publisher rejoins through EntryTradingRoom.
+	// A freshly generated ID is another room and leaves the existing one alone.
+	if existing != nil && roomId == requestData.RoomId && roomStatus(existing) == RoomLive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"status":  "error",
-			"message": fmt.Sprintf("Error fetching product details: %v", err),
+			"message": "Room is already live, rejoin it instead of creating it again",
 		})
 	}
 
 	// Assign values to RoomDetails
 	roomDetails := RoomDetails{
-		Products:  fetchedProducts,
-		Publisher: user,
-		Title:     requestData.Title,
+		Publisher:   user,
+		Title:       requestData.Title,
+		AllowGuests: requestData.AllowGuests,
+		Moderators:  requestData.Moderators,
+		Status:      RoomLive,
+	}
+	if scheduled != nil {
+		// The ingress survives going live, the encoder keeps its stream key
+		roomDetails.Ingress = scheduled.Ingress
+		roomDetails.Products = scheduled.Products
+		roomDetails.Slug = scheduled.Slug
+		roomDetails.StartAt = scheduled.StartAt
+		roomDetails.CoverImage = scheduled.CoverImage
+		roomDetails.AllowGuests = roomDetails.AllowGuests || scheduled.AllowGuests
+		if roomDetails.Title == "" {
+			roomDetails.Title = scheduled.Title
+		}
+		if len(roomDetails.Moderators) == 0 {
+			roomDetails.Moderators = scheduled.Moderators
+		}
 	}
 
-	// Convert roomDetails into a JSON string
-	roomDetailsJSON, err := json.Marshal(roomDetails)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Failed to serialize room details",
-		})
+	// Fetch the details of requestData.Products to store them with the room,
+	// a promoted room keeps the announced products unless new ones are sent
+	if scheduled == nil || len(requestData.Products) > 0 {
+		fetchedProducts, err := Products.FetchProducts(c.Context(), requestData.Products, user.ID)
+		if err != nil {
+			return backendFailure(c, err)
+		}
+		roomDetails.Products = fetchedProducts
 	}
 
-	livekitToken, err := utils.CreateToken(true, requestData.RoomId, user.ID, user.Name, user.Photo, config)
+	livekitToken, err := utils.CreateToken(utils.RolePublisher, roomId, user.ID, user.Name, participantMetadata(c, config, user), config)
 
 	if err != nil {
 		// Handler case when user details are not properly set or wrong type
@@ -96,72 +167,101 @@ func CreateTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 		})
 	}
 
-	streaming := Streaming{
-		Title:     requestData.Title,
-		RoomID:    requestData.RoomId,
+	streaming := backend.Streaming{
+		Title:     roomDetails.Title,
+		RoomID:    roomId,
 		UserID:    user.ID,
 		CreatedAt: time.Now(),
 	}
-	jsonData, err := json.Marshal(streaming)
-	if err != nil {
+
+	// The token is only handed out once every step below succeeded, a failing step undoes the earlier ones
+	err = utils.RunSaga(initializers.Ctx, createRoomSteps(roomId, &roomDetails, streaming, config))
+	var sagaErr *utils.SagaError
+	if errors.As(err, &sagaErr) && len(sagaErr.UndoErrors) > 0 {
+		// What could not be undone, like an orphaned backend record, has to be cleaned up by hand
+		log.Printf("Rollback of room %s is incomplete: %v", roomId, err)
+	}
+	if errors.Is(err, errRoomTaken) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room is already owned by another publisher",
+		})
+	} else if errors.As(err, new(*backend.Error)) {
+		return backendFailure(c, err)
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to marshal JSON data",
+			"message": fmt.Sprintf("Failed to create room: %v", err),
 		})
 	}
-	req, err := http.NewRequest("POST", config.Backend.Uri+"/profile/streaming", bytes.NewBuffer(jsonData))
 
-	fmt.Println(req)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"token":  livekitToken,
+			"roomId": roomId,
+			"slug":   roomDetails.Slug,
+		},
+	})
+}
 
-	if err != nil {
+func EntryTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
+
+	// Define the struct to get livekit Token
+	type RequestData struct {
+		RoomId string `json:"roomId"`
+	}
+
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to create request",
+			"message": "Server error while retrieving user details",
 		})
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	res, err := client.Do(req)
 
-	if res.StatusCode != http.StatusOK {
-		bodyBytes, _ := ioutil.ReadAll(res.Body)
-		bodyString := string(bodyBytes)
+	// Parse the POST request body into the struct
+	requestData := new(RequestData)
+	if err := c.BodyParser(requestData); err != nil {
+		// Handle parsing error
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": fmt.Sprintf("Backend request failed with status %d: %s", res.StatusCode, bodyString),
+			"message": fmt.Sprintf("Failed to parse request body: %v", err),
 		})
 	}
 
-	if err != nil {
+	roomDetails, err := getRoomDetails(requestData.RoomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to execute request",
+			"message": "Error fetching room details",
 		})
 	}
-	titleLookupKey := "room_titles"
 
-	// After successfully generating a livekit token and before returning success response:
-	err = initializers.RedisClient.Set(initializers.Ctx, "room:"+requestData.RoomId, roomDetailsJSON, 12*time.Hour).Err()
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	// A publisher token for an existing room is only handed out to its owner
+	if !canManageRoom(user, roomDetails) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to store room data in Redis",
+			"message": "You are not the owner of this room",
 		})
 	}
 
-	// Storing title with reference to roomId in a sorted set
-	err = initializers.RedisClient.ZAdd(initializers.Ctx, titleLookupKey, redis.Z{
-		Score:  0, // You can use Unix timestamp or any other scoring logic if needed
-		Member: requestData.RoomId + ":" + requestData.Title,
-	}).Err()
+	livekitToken, err := utils.CreateToken(roomRole(user, roomDetails), requestData.RoomId, user.ID, user.Name, participantMetadata(c, config, user), config)
 
 	if err != nil {
+		// Handler case when user details are not properly set or wrong type
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to index room title in Redis",
+			"message": "Error while Generating Livekit Token",
 		})
 	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status": "success",
 		"data": fiber.Map{
@@ -170,13 +270,10 @@ func CreateTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 	})
 }
 
-func EntryTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
-
-	// Define the struct to get livekit Token
-	type RequestData struct {
-		RoomId string `json:"roomId"`
-	}
+func JoinTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
 
+	// The viewer identity always comes from the auth server, never from the body
 	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
 	if !ok {
 		// Handler case when user details are not properly set or wrong type
@@ -186,16 +283,32 @@ func EntryTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 		})
 	}
 
-	// Parse the POST request body into the struct
-	requestData := new(RequestData)
-	if err := c.BodyParser(requestData); err != nil {
-		// Handle parsing error
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": fmt.Sprintf("Failed to parse request body: %v", err),
+			"message": "Error fetching room details",
 		})
 	}
-	livekitToken, err := utils.CreateToken(true, requestData.RoomId, user.ID, user.Name, user.Photo, config)
+
+	if banned, err := isBanned(roomId, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room bans",
+		})
+	} else if banned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are banned from this room",
+		})
+	}
+
+	livekitToken, err := utils.CreateToken(roomRole(user, roomDetails), roomId, user.ID, user.Name, participantMetadata(c, config, user), config)
 
 	if err != nil {
 		// Handler case when user details are not properly set or wrong type
@@ -213,49 +326,39 @@ func EntryTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 	})
 }
 
-func JoinTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
-
-	// // Define the struct to get livekit Token
+func JoinTradingRoomAsGuest(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
 
-	type RequestData struct {
-		UserId    string `json:"userId"`
-		UserPhoto string `json:"photo"`
-		UserName  string `json:"userName"`
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
 	}
 
-	roomId := c.Params("roomId")
-
-	// Fetch room details from Redis
-	// _, err := initializers.RedisClient.Get(initializers.Ctx, "room:"+roomId).Result()
-
-	// if err == redis.Nil {
-	// 	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-	// 		"status":  "error",
-	// 		"message": "Room not found",
-	// 	})
-	// }
-	// user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
-	// if !ok {
-	// 	// Handler case when user details are not properly set or wrong type
-	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-	// 		"status":  "error",
-	// 		"message": "Server error while retrieving user details",
-	// 	})
-	// }
-
-	// // Parse the POST request body into the struct
-	requestData := &RequestData{}
-	// var userId UserId
+	if !roomDetails.AllowGuests {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Guests are not allowed in this room",
+		})
+	}
 
-	if err := c.BodyParser(requestData); err != nil {
-		// Handle parsing error
+	// Guests never choose their identity or display name
+	guestId, guestName, err := utils.NewGuestIdentity()
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": fmt.Sprintf("Failed to parse request body: %v", err),
+			"message": "Error while generating guest identity",
 		})
 	}
 
-	livekitToken, err := utils.CreateToken(false, roomId, requestData.UserId, requestData.UserName, requestData.UserPhoto, config)
+	livekitToken, err := utils.CreateToken(utils.RoleMutedViewer, roomId, guestId, guestName, participantMetadata(c, config, middleware.UserDetailsResponse{}), config)
 
 	if err != nil {
 		// Handler case when user details are not properly set or wrong type
@@ -268,7 +371,9 @@ func JoinTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status": "success",
 		"data": fiber.Map{
-			"token": livekitToken,
+			"token":    livekitToken,
+			"identity": guestId,
+			"name":     guestName,
 		},
 	})
 }
@@ -299,6 +404,12 @@ func GetTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 			"message": "Failed to deserialize room details",
 		})
 	}
+	states, err := loadLiveStates([]string{roomId})
+	if err != nil {
+		log.Printf("Failed to load live state of room %s: %v", roomId, err)
+	}
+	roomDetails.Live = states[roomId]
+	loadIngressStatus(c.Context(), &roomDetails)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status": "success",
@@ -307,42 +418,88 @@ func GetTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 
 }
 
+func ResolveRoomSlug(c *fiber.Ctx, config *initializers.Config) error {
+	roomId, err := initializers.RedisClient.Get(initializers.Ctx, slugPrefix+c.Params("slug")).Result()
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error resolving room link",
+		})
+	}
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Error fetching room details",
+		})
+	}
+	states, err := loadLiveStates([]string{roomId})
+	if err != nil {
+		log.Printf("Failed to load live state of room %s: %v", roomId, err)
+	}
+	roomDetails.Live = states[roomId]
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"roomId": roomId,
+			"room":   roomDetails,
+		},
+	})
+}
+
 func GetAllTradingRooms(c *fiber.Ctx, config *initializers.Config) error {
-	// WARNING: Use of KEYS in production environments with large data sets is discouraged.
-	keys, err := initializers.RedisClient.Keys(initializers.Ctx, "room:*").Result()
+	cursor, err := utils.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid cursor",
+		})
+	}
+	limit := utils.ParseLimit(c.Query("limit"))
+
+	// Rooms come from the registry, newest first
+	order, rooms, next, err := listActiveRooms(cursor, limit)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Error fetching rooms",
 		})
 	}
+	attachLiveStates(rooms)
 
-	// Prepare a map to hold room data
-	rooms := make(map[string]RoomDetails)
-	for _, key := range keys {
-		val, err := initializers.RedisClient.Get(initializers.Ctx, key).Result()
-		if err != nil {
-			continue // Optionally log this error
-		}
-
-		var roomDetails RoomDetails
-		if err := json.Unmarshal([]byte(val), &roomDetails); err != nil {
-			continue // Optionally log this error
-		}
-
-		// Extract roomId from the key and use it as a map key
-		roomId := strings.TrimPrefix(key, "room:")
-		rooms[roomId] = roomDetails
+	nextCursor := ""
+	if next != nil {
+		nextCursor = next.Encode()
 	}
 
-	// Encode the entire map as a JSON object
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status": "success",
 		"rooms":  rooms,
+		"order":  order,
+		"meta": fiber.Map{
+			"limit":      limit,
+			"nextCursor": nextCursor,
+		},
 	})
 }
 
 func GetRooms(c *fiber.Ctx, config *initializers.Config) error {
+	if c.Query("status") == "upcoming" {
+		return GetUpcomingRooms(c, config)
+	}
+
 	queryParams := url.Values{}
 	queryParams.Add("page", c.Query("page"))
 	queryParams.Add("city", c.Query("city"))
@@ -351,83 +508,93 @@ func GetRooms(c *fiber.Ctx, config *initializers.Config) error {
 	queryParams.Add("money", c.Query("money"))
 	queryParams.Add("language", c.Query("language"))
 	title := c.Query("title")
-	req, err := http.NewRequest("GET", config.Backend.Uri+"/profiles/streaming"+"?"+queryParams.Encode(), nil)
 
+	response, err := Backend.ListStreamings(c.Context(), queryParams)
+	if err != nil {
+		return backendFailure(c, err)
+	}
+	streamings := response.Data
+	roomIds := make([]string, 0, len(streamings))
+	for _, streaming := range streamings {
+		roomIds = append(roomIds, strings.TrimPrefix(streaming.RoomID, "room:"))
+	}
+	storedRooms, err := getRoomDetailsBatch(roomIds)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to create request",
+			"message": "Error fetching rooms",
 		})
 	}
-	req.Header.Set("Content-Type", "application/json")
+	rooms := make(map[string]RoomDetails)
+	for roomId, roomDetails := range storedRooms {
+		if strings.Contains(roomDetails.Title, title) || title == "all" || title == "" {
+			rooms[roomId] = roomDetails
+		}
+	}
+	attachLiveStates(rooms)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"rooms":  rooms,
+	})
+}
 
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
+func DeleteTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to delete room data in Redis",
+			"message": "Server error while retrieving user details",
 		})
 	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		bodyBytes, _ := ioutil.ReadAll(res.Body)
-		bodyString := string(bodyBytes)
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": fmt.Sprintf("Backend request failed with status %d: %s", res.StatusCode, bodyString),
+			"message": "Error fetching room details",
 		})
 	}
-	// type Profile struct {
-	// 	ID        string      `json:"ID"`
-	// 	UserID    string      `json:"UserID"`
-	// 	Firstname string      `json:"Firstname"`
-	// 	Descr     string      `json:"Descr"`
-	// 	Streaming []Streaming `json:"streaming"`
-	// }
-	type Meta struct {
-		Limit int `json:"limit"`
-		Total int `json:"total"`
-	}
 
-	type Response struct {
-		Data   []Streaming `json:"data"`
-		Meta   Meta        `json:"meta"`
-		Status string      `json:"status"`
-	}
-	var streamings []Streaming
-	var response Response
-	bodyBytes, err := ioutil.ReadAll(res.Body)
-	if err := json.Unmarshal(bodyBytes, &response); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	// Only the publisher of the room or an admin may delete it
+	if !canManageRoom(user, roomDetails) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to decode backend response",
+			"message": "You are not the owner of this room",
 		})
 	}
-	streamings = response.Data
-	rooms := make(map[string]RoomDetails)
-	for _, streaming := range streamings {
-		val, err := initializers.RedisClient.Get(initializers.Ctx, "room:"+streaming.RoomID).Result()
-		if err != nil {
-			continue
-		}
 
-		var roomDetails RoomDetails
-		if err := json.Unmarshal([]byte(val), &roomDetails); err != nil {
-			continue
-		}
-		if strings.Contains(roomDetails.Title, title) || title == "all" || title == "" { // Extract roomId from the key and use it as a map key
-			roomId := strings.TrimPrefix(streaming.RoomID, "room:")
-			rooms[roomId] = roomDetails
+	if err := endRoom(c.Context(), roomId, roomDetails, config); err != nil {
+		var backendErr *backend.Error
+		if errors.As(err, &backendErr) {
+			return backendFailure(c, err)
 		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to delete room: %v", err),
+		})
 	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status": "success",
-		"rooms":  rooms,
 	})
 }
 
-func DeleteTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
+// UpdateTradingRoom changes the title, products or cover of a room, also while it is live
+func UpdateTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
+	// Fields left out stay as they are
+	type RequestData struct {
+		Title      *string   `json:"title"`
+		Products   *[]string `json:"products"`
+		CoverImage *string   `json:"coverImage"`
+	}
+
 	roomId := c.Params("roomId")
 	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
 	if !ok {
@@ -438,105 +605,218 @@ func DeleteTradingRoom(c *fiber.Ctx, config *initializers.Config) error {
 		})
 	}
 
-	type RequestData struct {
-		UserID    string    `json:"userID"`
-		DeletedAt time.Time `json:"time"`
+	requestData := new(RequestData)
+	if err := c.BodyParser(requestData); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Failed to parse request body: %v", err),
+		})
 	}
-	requestData := RequestData{UserID: user.ID, DeletedAt: time.Now()}
-	jsonData, err := json.Marshal(requestData)
-	fmt.Println("deletedAt:" + requestData.DeletedAt.String())
-	if err != nil {
+	if requestData.Title != nil && strings.TrimSpace(*requestData.Title) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Title can't be empty",
+		})
+	}
+
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to marshal JSON data",
+			"message": "Error fetching room details",
 		})
 	}
-	req, err := http.NewRequest("DELETE", config.Backend.Uri+"/profile/streaming/"+roomId, bytes.NewBuffer(jsonData))
 
-	if err != nil {
+	if !canManageRoom(user, roomDetails) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not the owner of this room",
+		})
+	}
+
+	// Products belong to the publisher, also when an admin edits the room. The cache is bypassed,
+	// the publisher may have changed prices or stock of the same products.
+	var fetchedProducts json.RawMessage
+	if requestData.Products != nil {
+		fetchedProducts, err = catalog.FetchFreshProducts(c.Context(), Products, *requestData.Products, roomDetails.Publisher.ID)
+		if err != nil {
+			return backendFailure(c, err)
+		}
+	}
+
+	updated, err := updateRoomDetails(c.Context(), roomId, func(roomDetails *RoomDetails) error {
+		if requestData.Title != nil {
+			roomDetails.Title = strings.TrimSpace(*requestData.Title)
+		}
+		if requestData.Products != nil {
+			roomDetails.Products = fetchedProducts
+			// A pinned product which is no longer offered is unpinned
+			if roomDetails.Pinned != nil {
+				if _, ok := findProduct(fetchedProducts, roomDetails.Pinned.ProductID); !ok {
+					roomDetails.Pinned = nil
+				}
+			}
+		}
+		if requestData.CoverImage != nil {
+			roomDetails.CoverImage = *requestData.CoverImage
+		}
+		return nil
+	})
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if errors.Is(err, errRoomChanged) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room was changed meanwhile, try again",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to create request",
+			"message": fmt.Sprintf("Failed to update room: %v", err),
 		})
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	res, err := client.Do(req)
+	// Only live rooms are searchable, a scheduled room is indexed once it goes live
+	if roomStatus(updated) == RoomLive {
+		if err := RoomSearch.Put(c.Context(), roomId, searchDocument(*updated)); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": fmt.Sprintf("Failed to update search index: %v", err),
+			})
+		}
+	}
 
-	if res.StatusCode != http.StatusOK {
-		bodyBytes, _ := ioutil.ReadAll(res.Body)
-		bodyString := string(bodyBytes)
+	// Scheduled rooms have nobody to notify yet
+	notified := false
+	if roomStatus(updated) == RoomLive {
+		notified = pushRoomMetadata(c.Context(), roomId, updated)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"room":     updated,
+			"notified": notified,
+		},
+	})
+}
+
+// RoomHeartbeat is called periodically by the client driving the stream, the publisher, an admin
+// or a co-host. It keeps a live room from being reaped and from expiring while the stream goes on
+func RoomHeartbeat(c *fiber.Ctx, config *initializers.Config) error {
+	roomId := c.Params("roomId")
+	user, ok := c.Locals("userDetails").(middleware.UserDetailsResponse)
+	if !ok {
+		// Handler case when user details are not properly set or wrong type
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": fmt.Sprintf("Backend request failed with status %d: %s", res.StatusCode, bodyString),
+			"message": "Server error while retrieving user details",
 		})
 	}
 
-	bodyBytes, _ := ioutil.ReadAll(res.Body)
-	bodyString := string(bodyBytes)
-	fmt.Println(bodyString)
-	if err != nil {
+	roomDetails, err := getRoomDetails(roomId)
+	if err == redis.Nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Room not found",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to delete room data in Redis",
+			"message": "Error fetching room details",
 		})
 	}
 
-	err = initializers.RedisClient.Del(initializers.Ctx, "room:"+roomId).Err()
+	// Admins and co-hosts may drive the stream while the owner's client is gone
+	if !canManageRoom(user, roomDetails) && !contains(roomDetails.CoHosts, user.ID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "You are not the owner of this room",
+		})
+	}
+	if roomStatus(roomDetails) != RoomLive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "error",
+			"message": fmt.Sprintf("Room is %s", roomStatus(roomDetails)),
+		})
+	}
+
+	now := time.Now()
+	err = updateRoomState(roomId, func(pipe redis.Pipeliner, key string) {
+		pipe.HSet(initializers.Ctx, key, "heartbeatAt", now.Unix())
+		pipe.Expire(initializers.Ctx, "room:"+roomId, roomTTL)
+		pipe.Expire(initializers.Ctx, roomViewersPrefix+roomId, roomTTL)
+		pipe.Expire(initializers.Ctx, bansPrefix+roomId, roomTTL)
+		pipe.Expire(initializers.Ctx, chatSettingsPrefix+roomId, roomTTL)
+		if roomDetails.Slug != "" {
+			pipe.Expire(initializers.Ctx, slugPrefix+roomDetails.Slug, roomTTL)
+		}
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": fmt.Sprintf("Failed to delete room data from Redis: %v", err),
+			"message": "Error storing heartbeat",
 		})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"status": "success",
+		"data": fiber.Map{
+			"heartbeatAt": now,
+			"expiresAt":   now.Add(roomTTL),
+		},
 	})
 }
 
-func fetchProductDetailsFromBackend(productIDs []string, publisherID string) ([]byte, error) {
-	// Construct the request payload
-	requestPayload := struct {
-		IDs       []string `json:"ids"`
-		Publisher string   `json:"publisher"`
-	}{
-		IDs:       productIDs,
-		Publisher: publisherID,
-	}
-
-	// Convert the request payload to JSON bytes
-	payloadBytes, err := json.Marshal(requestPayload)
+// getRoomDetails loads the stored details of a room, returns redis.Nil when it does not exist
+func getRoomDetails(roomId string) (*RoomDetails, error) {
+	val, err := initializers.RedisClient.Get(initializers.Ctx, "room:"+roomId).Result()
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request payload: %w", err)
+		return nil, err
 	}
 
-	// Execute the POST request to the backend service
-	resp, err := http.Post("https://go.paxintrade.com/api/blog/filterByIds", "application/json", bytes.NewReader(payloadBytes))
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch data from backend: %w", err)
+	var roomDetails RoomDetails
+	if err := json.Unmarshal([]byte(val), &roomDetails); err != nil {
+		return nil, fmt.Errorf("failed to deserialize room details: %w", err)
 	}
-	defer resp.Body.Close()
+	return &roomDetails, nil
+}
 
-	// Check if the response status code is not 200
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("backend responded with non-200 status code: %d", resp.StatusCode)
-	}
+// canManageRoom reports whether the user owns the room or is an admin
+func canManageRoom(user middleware.UserDetailsResponse, roomDetails *RoomDetails) bool {
+	return user.IsAdmin() || user.ID == roomDetails.Publisher.ID
+}
 
-	// Assuming the structure of the response for our case is known and consistent
-	// Decode the entire response to access the Blogs part
-	var backendResponse struct {
-		Blogs  json.RawMessage `json:"blogs"` // Use json.RawMessage to get the raw JSON
-		Status string          `json:"status"`
+// roomRole selects the grant profile the user joins the room with
+func roomRole(user middleware.UserDetailsResponse, roomDetails *RoomDetails) string {
+	if user.ID == roomDetails.Publisher.ID {
+		return utils.RolePublisher
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&backendResponse); err != nil {
-		return nil, fmt.Errorf("failed to decode backend response: %w", err)
+	if user.IsRecorder() {
+		return utils.RoleRecorder
 	}
-
-	// If needed, perform further processing on backendResponse.Blogs, which is raw JSON
-
-	// Return the raw JSON of the Blogs part directly
-	return backendResponse.Blogs, nil
+	// Guests aren't moderated like signed in viewers, they don't get to send data messages
+	if utils.IsGuestIdentity(user.ID) {
+		return utils.RoleMutedViewer
+	}
+	if user.IsAdmin() {
+		return utils.RoleModerator
+	}
+	if contains(roomDetails.CoHosts, user.ID) {
+		return utils.RoleCoHost
+	}
+	for _, moderator := range roomDetails.Moderators {
+		if moderator == user.ID {
+			return utils.RoleModerator
+		}
+	}
+	return utils.RoleViewer
 }
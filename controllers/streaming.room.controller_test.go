@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"streaming/initializers"
+	"streaming/middleware"
+	"streaming/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// noProducts is a catalog without any products
+type noProducts struct{}
+
+func (noProducts) FetchProducts(ctx context.Context, ids []string, publisherId string) (json.RawMessage, error) {
+	return json.RawMessage("[]"), nil
+}
+
+// storeRoom overwrites the stored details of a room, keeping its TTL
+func storeRoom(t *testing.T, roomId string, roomDetails *RoomDetails) {
+	t.Helper()
+	roomDetailsJSON, _ := json.Marshal(roomDetails)
+	if err := initializers.RedisClient.SetArgs(initializers.Ctx, "room:"+roomId, roomDetailsJSON, redis.SetArgs{KeepTTL: true}).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateTradingRoomExisting(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         string
+		allowClientIds bool
+		want           int
+		wantSameRoom   bool
+	}{
+		{name: "scheduled room goes live", status: RoomScheduled, allowClientIds: true, want: fiber.StatusOK, wantSameRoom: true},
+		{name: "live room again", status: RoomLive, allowClientIds: true, want: fiber.StatusConflict},
+		{name: "live room with generated IDs", status: RoomLive, allowClientIds: false, want: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, stub := setupServices(t)
+			Products = noProducts{}
+			liveRoom(t, "room", time.Minute, roomTTL, true)
+			existing, _ := getRoomDetails("room")
+			existing.Status = tt.status
+			existing.Slug = "gold"
+			existing.CoHosts = []string{"cohost"}
+			existing.Ingress = &RoomIngress{ID: "IN_room", Type: "rtmp"}
+			storeRoom(t, "room", existing)
+			mr.Set(slugPrefix+"gold", "room")
+
+			config := &initializers.Config{
+				LiveKit: initializers.LiveKitConfig{APIKey: "key", APISecret: "a-secret-of-at-least-32-characters"},
+				Rooms:   initializers.RoomsConfig{AllowClientIds: tt.allowClientIds},
+			}
+			app := fiber.New()
+			app.Post("/rooms", func(c *fiber.Ctx) error {
+				c.Locals("userDetails", middleware.UserDetailsResponse{ID: "owner"})
+				return CreateTradingRoom(c, config)
+			})
+
+			req := httptest.NewRequest("POST", "/rooms", strings.NewReader(`{"roomId":"room","title":"Gold"}`))
+			req.Header.Set("Content-Type", "application/json")
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			if res.StatusCode != tt.want {
+				t.Fatalf("status %d, want %d: %s", res.StatusCode, tt.want, body)
+			}
+
+			// The existing room is left alone unless it was promoted
+			stored, err := getRoomDetails("room")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantSameRoom && (stored.Slug != "gold" || !reflect.DeepEqual(stored.CoHosts, []string{"cohost"})) {
+				t.Errorf("existing room = %+v, want slug and co-hosts kept", stored)
+			}
+			if tt.want != fiber.StatusOK {
+				if len(stub.created) != 0 {
+					t.Errorf("backend streams = %q, want none", stub.created)
+				}
+				return
+			}
+
+			var response struct {
+				Data struct {
+					RoomID string `json:"roomId"`
+					Slug   string `json:"slug"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(body, &response); err != nil {
+				t.Fatal(err)
+			}
+			if got := response.Data.RoomID == "room"; got != tt.wantSameRoom {
+				t.Fatalf("room ID = %q, same room %t, want %t", response.Data.RoomID, got, tt.wantSameRoom)
+			}
+			created, err := getRoomDetails(response.Data.RoomID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantSameRoom && (created.Ingress == nil || created.Ingress.ID != "IN_room" || response.Data.Slug != "gold") {
+				t.Errorf("promoted room = %+v, want the existing ingress and slug", created)
+			}
+			if !tt.wantSameRoom && created.Ingress != nil {
+				t.Errorf("ingress = %+v, want none for a new room", created.Ingress)
+			}
+		})
+	}
+}
+
+func TestRoomRole(t *testing.T) {
+	roomDetails := &RoomDetails{
+		Publisher:  middleware.UserDetailsResponse{ID: "owner"},
+		CoHosts:    []string{"cohost"},
+		Moderators: []string{"mod"},
+	}
+	tests := []struct {
+		name string
+		user middleware.UserDetailsResponse
+		want string
+	}{
+		{"publisher", middleware.UserDetailsResponse{ID: "owner"}, utils.RolePublisher},
+		{"recorder bot", middleware.UserDetailsResponse{ID: "bot", Role: middleware.RoleRecorder}, utils.RoleRecorder},
+		{"guest", middleware.UserDetailsResponse{ID: "guest-0123456789abcdef"}, utils.RoleMutedViewer},
+		{"admin", middleware.UserDetailsResponse{ID: "admin", Role: middleware.RoleAdmin}, utils.RoleModerator},
+		{"co-host", middleware.UserDetailsResponse{ID: "cohost"}, utils.RoleCoHost},
+		{"moderator", middleware.UserDetailsResponse{ID: "mod"}, utils.RoleModerator},
+		{"viewer", middleware.UserDetailsResponse{ID: "viewer"}, utils.RoleViewer},
+	}
+	for _, tt := range tests {
+		if got := roomRole(tt.user, roomDetails); got != tt.want {
+			t.Errorf("%s: roomRole() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoomHeartbeatAccess(t *testing.T) {
+	tests := []struct {
+		name string
+		user middleware.UserDetailsResponse
+		want int
+	}{
+		{"owner", middleware.UserDetailsResponse{ID: "owner"}, fiber.StatusOK},
+		{"admin", middleware.UserDetailsResponse{ID: "admin", Role: middleware.RoleAdmin}, fiber.StatusOK},
+		{"co-host", middleware.UserDetailsResponse{ID: "cohost"}, fiber.StatusOK},
+		{"viewer", middleware.UserDetailsResponse{ID: "viewer"}, fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, _ := setupServices(t)
+			liveRoom(t, "room", time.Hour, roomTTL, false)
+			roomDetails, _ := getRoomDetails("room")
+			roomDetails.CoHosts = []string{"cohost"}
+			roomDetailsJSON, _ := json.Marshal(roomDetails)
+			mr.Set("room:room", string(roomDetailsJSON))
+
+			app := fiber.New()
+			app.Post("/rooms/:roomId/heartbeat", func(c *fiber.Ctx) error {
+				c.Locals("userDetails", tt.user)
+				return RoomHeartbeat(c, &initializers.Config{})
+			})
+			res, err := app.Test(httptest.NewRequest("POST", "/rooms/room/heartbeat", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", res.StatusCode, tt.want)
+			}
+			if beat := mr.HGet(roomStatePrefix+"room", "heartbeatAt"); (beat != "") != (tt.want == fiber.StatusOK) {
+				t.Errorf("heartbeatAt = %q after status %d", beat, res.StatusCode)
+			}
+		})
+	}
+}
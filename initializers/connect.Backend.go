@@ -0,0 +1,61 @@
+package initializers
+
+import (
+	"fmt"
+	"streaming/backend"
+	"streaming/catalog"
+	"streaming/subscriptions"
+	"time"
+)
+
+// NewBackendClient builds the backend client from the "backend" section of the config
+func NewBackendClient(config *Config) (*backend.HTTPClient, error) {
+	var timeout time.Duration
+	if config.Backend.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(config.Backend.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid backend timeout %q: %w", config.Backend.Timeout, err)
+		}
+	}
+
+	retries := backend.DefaultRetries
+	if config.Backend.Retries != nil {
+		retries = *config.Backend.Retries
+	}
+
+	return backend.NewHTTPClient(config.Backend.Uri, timeout, retries).WithProductsURL(config.Products.Uri), nil
+}
+
+// NewSubscriptionChecker builds the checker of subscriber-only chats, Disabled without chat.subscriptions_uri
+func NewSubscriptionChecker(config *Config, client *backend.HTTPClient) subscriptions.Checker {
+	if config.Chat.SubscriptionsUri == "" {
+		return subscriptions.Disabled{}
+	}
+	return client.WithSubscriptionsURL(config.Chat.SubscriptionsUri)
+}
+
+// NewProductCatalog builds the product catalog from the "products" section of the config
+func NewProductCatalog(config *Config, client backend.Client) (catalog.ProductCatalog, error) {
+	var products catalog.ProductCatalog
+	switch config.Products.Source {
+	case "", "http":
+		products = catalog.NewHTTPCatalog(client, config.Products.BatchSize)
+	case "file":
+		fileCatalog, err := catalog.NewFileCatalog(config.Products.FixtureFile)
+		if err != nil {
+			return nil, err
+		}
+		products = fileCatalog
+	default:
+		return nil, fmt.Errorf("unknown products source %q", config.Products.Source)
+	}
+
+	if config.Products.CacheTTL == "" {
+		return products, nil
+	}
+	ttl, err := time.ParseDuration(config.Products.CacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid products cache ttl %q: %w", config.Products.CacheTTL, err)
+	}
+	return catalog.NewCachedCatalog(products, RedisClient, ttl), nil
+}
@@ -0,0 +1,12 @@
+package initializers
+
+import "streaming/chatfilter"
+
+// NewChatFilter builds the chat moderation pipeline from the "chat" section of the config.
+// An external classifier would be appended to the chain here.
+func NewChatFilter(config *Config) chatfilter.Filter {
+	return chatfilter.Chain{
+		chatfilter.NewWordFilter(config.Chat.BannedWords),
+		chatfilter.LinkFilter{},
+	}
+}
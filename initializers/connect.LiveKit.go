@@ -0,0 +1,50 @@
+package initializers
+
+import (
+	"fmt"
+	"streaming/livekitapi"
+)
+
+// NewLiveKitClient builds the LiveKit server API client from the "livekit" section of the config
+func NewLiveKitClient(config *Config) (*livekitapi.TwirpClient, error) {
+	uri := config.LiveKit.APIUri
+	if uri == "" {
+		uri = config.LiveKit.Uri
+	}
+	if uri == "" || config.LiveKit.APIKey == "" || config.LiveKit.APISecret == "" {
+		return nil, fmt.Errorf("livekit uri, api_key and api_secret are required")
+	}
+	return livekitapi.NewTwirpClient(uri, config.LiveKit.APIKey, config.LiveKit.APISecret), nil
+}
+
+// NewRecordingOutput builds the egress output of recordings from the "recording" section of the config
+func NewRecordingOutput(config *Config) (livekitapi.RecordingOutput, error) {
+	output := livekitapi.RecordingOutput{
+		Filepath:  config.Recording.Filepath,
+		Layout:    config.Recording.Layout,
+		AudioOnly: config.Recording.AudioOnly,
+	}
+	if output.Filepath == "" {
+		output.Filepath = "recordings/{room_name}/{time}"
+	}
+
+	switch config.Recording.Output {
+	case "", "file":
+	case "s3":
+		s3 := config.Recording.S3
+		if s3.Bucket == "" {
+			return output, fmt.Errorf("recording s3 bucket is required")
+		}
+		output.S3 = &livekitapi.S3Output{
+			AccessKey:      s3.AccessKey,
+			Secret:         s3.Secret,
+			Region:         s3.Region,
+			Endpoint:       s3.Endpoint,
+			Bucket:         s3.Bucket,
+			ForcePathStyle: s3.ForcePathStyle,
+		}
+	default:
+		return output, fmt.Errorf("unknown recording output %q", config.Recording.Output)
+	}
+	return output, nil
+}
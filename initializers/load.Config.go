@@ -1,17 +1,25 @@
 package initializers
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 // Config represents the top-level structure of the YAML configuration
 type Config struct {
-	Auth    AuthConfig    `yaml:"auth"`
-	LiveKit LiveKitConfig `yaml:"livekit"`
-	Redis   RedisConfig   `yaml:"redis"`
-	Backend BackendConfig `yaml:"backend"`
+	Auth      AuthConfig      `yaml:"auth"`
+	LiveKit   LiveKitConfig   `yaml:"livekit"`
+	Redis     RedisConfig     `yaml:"redis"`
+	Backend   BackendConfig   `yaml:"backend"`
+	Search    SearchConfig    `yaml:"search"`
+	Products  ProductsConfig  `yaml:"products"`
+	Rooms     RoomsConfig     `yaml:"rooms"`
+	History   HistoryConfig   `yaml:"history"`
+	Chat      ChatConfig      `yaml:"chat"`
+	Recording RecordingConfig `yaml:"recording"`
 }
 
 // LiveKitConfig represents the nested "livekit" structure in the YAML
@@ -19,6 +27,80 @@ type LiveKitConfig struct {
 	Uri       string `yaml:"uri"`
 	APIKey    string `yaml:"api_key"`
 	APISecret string `yaml:"api_secret"`
+	// Server API base URL when it differs from uri
+	APIUri string `yaml:"api_uri"`
+	// Optional overrides of the built-in grant profiles, keyed by room role
+	GrantProfiles map[string]GrantProfile `yaml:"grant_profiles"`
+	// Token lifetimes like "6h" keyed by room role, "default" applies to the others
+	TokenTTL map[string]string `yaml:"token_ttl"`
+	// Participant metadata format for clients that don't send X-Metadata-Version
+	MetadataVersion int `yaml:"metadata_version"`
+	// How long before expiry a token may be refreshed, like "10m"
+	RefreshWindow string `yaml:"refresh_window"`
+
+	// TokenTTL and RefreshWindow as parsed by ParseTokenLifetimes
+	tokenTTLs     map[string]time.Duration
+	refreshWindow time.Duration
+}
+
+// ParseTokenLifetimes parses token_ttl and refresh_window once at startup, tokens are never issued with invalid values
+func (l *LiveKitConfig) ParseTokenLifetimes() error {
+	tokenTTLs := make(map[string]time.Duration, len(l.TokenTTL))
+	for role, value := range l.TokenTTL {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid token ttl %q of %s: %w", value, role, err)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("token ttl of %s must be positive, got %q", role, value)
+		}
+		tokenTTLs[role] = ttl
+	}
+
+	var refreshWindow time.Duration
+	if l.RefreshWindow != "" {
+		window, err := time.ParseDuration(l.RefreshWindow)
+		if err != nil {
+			return fmt.Errorf("invalid refresh window %q: %w", l.RefreshWindow, err)
+		}
+		if window <= 0 {
+			return fmt.Errorf("refresh window must be positive, got %q", l.RefreshWindow)
+		}
+		refreshWindow = window
+	}
+
+	l.tokenTTLs, l.refreshWindow = tokenTTLs, refreshWindow
+	return nil
+}
+
+// TokenLifetime returns the parsed token lifetime of a room role, or the "default" one, false when neither is configured
+func (l LiveKitConfig) TokenLifetime(role string) (time.Duration, bool) {
+	if ttl, ok := l.RoleTokenLifetime(role); ok {
+		return ttl, true
+	}
+	return l.RoleTokenLifetime("default")
+}
+
+// RoleTokenLifetime returns the parsed token lifetime configured for exactly this room role
+func (l LiveKitConfig) RoleTokenLifetime(role string) (time.Duration, bool) {
+	ttl, ok := l.tokenTTLs[role]
+	return ttl, ok
+}
+
+// RefreshWindowDuration returns the parsed refresh window, 0 when it is not configured
+func (l LiveKitConfig) RefreshWindowDuration() time.Duration {
+	return l.refreshWindow
+}
+
+// GrantProfile represents the LiveKit permissions given to a room role
+type GrantProfile struct {
+	CanPublish           bool     `yaml:"can_publish"`
+	CanSubscribe         bool     `yaml:"can_subscribe"`
+	CanPublishData       bool     `yaml:"can_publish_data"`
+	CanPublishSources    []string `yaml:"can_publish_sources"`
+	Hidden               bool     `yaml:"hidden"`
+	RoomAdmin            bool     `yaml:"room_admin"`
+	CanUpdateOwnMetadata bool     `yaml:"can_update_own_metadata"`
 }
 
 // AuthConfig represents the nested "auth" structure in the YAML
@@ -26,9 +108,13 @@ type AuthConfig struct {
 	Uri string `yaml:"uri"`
 }
 
-// BackendConfig represents the nested "auth" structure in the YAML
+// BackendConfig represents the nested "backend" structure in the YAML
 type BackendConfig struct {
 	Uri string `yaml:"uri"`
+	// Deadline of a single request like "10s"
+	Timeout string `yaml:"timeout"`
+	// Extra attempts for idempotent requests, defaults to 2
+	Retries *int `yaml:"retries"`
 }
 
 // RedisConfig represents the nested "redis" structure in the YAML
@@ -36,6 +122,173 @@ type RedisConfig struct {
 	Url string `yaml:"url"`
 }
 
+// SearchConfig represents the nested "search" structure in the YAML
+type SearchConfig struct {
+	// "redis" (default) or "memory" for a single local instance
+	Backend string `yaml:"backend"`
+}
+
+// ProductsConfig represents the nested "products" structure in the YAML
+type ProductsConfig struct {
+	// "http" (default) or "file" to serve FixtureFile for local development
+	Source string `yaml:"source"`
+	// Catalog endpoint, defaults to <backend.uri>/blog/filterByIds
+	Uri         string `yaml:"uri"`
+	FixtureFile string `yaml:"fixture_file"`
+	BatchSize   int    `yaml:"batch_size"`
+	// How long fetched products are reused like "10m", caching is off when empty
+	CacheTTL string `yaml:"cache_ttl"`
+}
+
+// RoomsConfig represents the nested "rooms" structure in the YAML
+type RoomsConfig struct {
+	// Compatibility for clients which still send their own roomId on creation
+	AllowClientIds bool `yaml:"allow_client_ids"`
+	// How long a live room may go without a publishing publisher or heartbeat like "2m", rooms are only ended on expiry when empty
+	PublisherGrace string `yaml:"publisher_grace"`
+	// How often the reaper looks for stale and expiring rooms like "30s"
+	ReaperInterval string `yaml:"reaper_interval"`
+	// Upper bound of simultaneous co-hosts per room
+	MaxCoHosts int `yaml:"max_cohosts"`
+	// How long a co-host invitation may be accepted like "2m"
+	CoHostInviteTTL string `yaml:"cohost_invite_ttl"`
+}
+
+// PublisherGraceDuration returns the configured grace period, 0 when rooms without publisher are not ended
+func (r RoomsConfig) PublisherGraceDuration() time.Duration {
+	grace, err := time.ParseDuration(r.PublisherGrace)
+	if err != nil || grace <= 0 {
+		return 0
+	}
+	return grace
+}
+
+// ReaperIntervalDuration returns the configured reaper interval, 30 seconds when missing or invalid
+func (r RoomsConfig) ReaperIntervalDuration() time.Duration {
+	interval, err := time.ParseDuration(r.ReaperInterval)
+	if err != nil || interval <= 0 {
+		return 30 * time.Second
+	}
+	return interval
+}
+
+// MaxCoHostsPerRoom returns the configured co-host cap, 3 when missing
+func (r RoomsConfig) MaxCoHostsPerRoom() int {
+	if r.MaxCoHosts <= 0 {
+		return 3
+	}
+	return r.MaxCoHosts
+}
+
+// CoHostInviteDuration returns how long invitations are valid, 2 minutes when missing or invalid
+func (r RoomsConfig) CoHostInviteDuration() time.Duration {
+	ttl, err := time.ParseDuration(r.CoHostInviteTTL)
+	if err != nil || ttl <= 0 {
+		return 2 * time.Minute
+	}
+	return ttl
+}
+
+// HistoryConfig represents the nested "history" structure in the YAML
+type HistoryConfig struct {
+	// How long ended rooms are kept like "720h"
+	Retention string `yaml:"retention"`
+	// Upper bound of archived rooms kept per publisher
+	MaxPerUser int `yaml:"max_per_user"`
+}
+
+// RetentionDuration returns the configured retention, 30 days when missing or invalid
+func (h HistoryConfig) RetentionDuration() time.Duration {
+	retention, err := time.ParseDuration(h.Retention)
+	if err != nil || retention <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return retention
+}
+
+// MaxRecordsPerUser returns the configured bound, 500 when missing
+func (h HistoryConfig) MaxRecordsPerUser() int {
+	if h.MaxPerUser <= 0 {
+		return 500
+	}
+	return h.MaxPerUser
+}
+
+// ChatConfig represents the nested "chat" structure in the YAML
+type ChatConfig struct {
+	// Messages kept per room, older ones are trimmed
+	MaxMessages int `yaml:"max_messages"`
+	// Longest message in characters
+	MaxLength int `yaml:"max_length"`
+	// Messages a user may send per rate_window and room
+	RateLimit  int    `yaml:"rate_limit"`
+	RateWindow string `yaml:"rate_window"`
+	// How long the chat of a room is kept after its last message like "24h"
+	Retention string `yaml:"retention"`
+	// Words and phrases banned in every room, rooms may add their own
+	BannedWords []string `yaml:"banned_words"`
+	// Whether rooms block links unless their moderators allow them
+	BlockLinks bool `yaml:"block_links"`
+	// Endpoint answering GET ?publisherId=&userId= with {"subscribed": bool}, rooms can't
+	// turn on subscriber-only chat without it
+	SubscriptionsUri string `yaml:"subscriptions_uri"`
+}
+
+// MaxMessagesPerRoom returns the configured cap, 1000 when missing
+func (c ChatConfig) MaxMessagesPerRoom() int64 {
+	if c.MaxMessages <= 0 {
+		return 1000
+	}
+	return int64(c.MaxMessages)
+}
+
+// MaxMessageLength returns the configured length, 500 when missing
+func (c ChatConfig) MaxMessageLength() int {
+	if c.MaxLength <= 0 {
+		return 500
+	}
+	return c.MaxLength
+}
+
+// Rate returns the configured rate limit, 5 messages per 10 seconds when missing or invalid
+func (c ChatConfig) Rate() (int, time.Duration) {
+	window, err := time.ParseDuration(c.RateWindow)
+	if err != nil || window < time.Second || c.RateLimit <= 0 {
+		return 5, 10 * time.Second
+	}
+	return c.RateLimit, window
+}
+
+// RetentionDuration returns the configured retention, 24 hours when missing or invalid
+func (c ChatConfig) RetentionDuration() time.Duration {
+	retention, err := time.ParseDuration(c.Retention)
+	if err != nil || retention <= 0 {
+		return 24 * time.Hour
+	}
+	return retention
+}
+
+// RecordingConfig represents the nested "recording" structure in the YAML
+type RecordingConfig struct {
+	// "file" keeps recordings on the egress server, "s3" uploads them
+	Output string `yaml:"output"`
+	// Egress file path template like "recordings/{room_name}/{time}.mp4"
+	Filepath  string   `yaml:"filepath"`
+	Layout    string   `yaml:"layout"`
+	AudioOnly bool     `yaml:"audio_only"`
+	S3        S3Config `yaml:"s3"`
+}
+
+// S3Config represents the nested "recording.s3" structure in the YAML
+type S3Config struct {
+	AccessKey      string `yaml:"access_key"`
+	Secret         string `yaml:"secret"`
+	Region         string `yaml:"region"`
+	Endpoint       string `yaml:"endpoint"`
+	Bucket         string `yaml:"bucket"`
+	ForcePathStyle bool   `yaml:"force_path_style"`
+}
+
 // ReadConfig reads and unmarshals YAML configuration from a file
 func LoadConfig() (*Config, error) {
 	configFile, err := os.ReadFile("config.yaml")
@@ -0,0 +1,194 @@
+package livekitapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+	"github.com/twitchtv/twirp"
+)
+
+// DefaultTimeout applies to every call to the LiveKit server API
+const DefaultTimeout = 10 * time.Second
+
+// How long the access tokens signed for single API calls are valid
+const callTokenTTL = time.Minute
+
+// ErrNotFound is returned when LiveKit has no such room, participant, egress or ingress, a room only exists once somebody joined
+var ErrNotFound = errors.New("livekit room or participant not found")
+
+// Client is the part of the LiveKit server API the streaming service uses
+type Client interface {
+	// UpdateRoomMetadata replaces the metadata of a room and pushes it to all participants
+	UpdateRoomMetadata(ctx context.Context, roomId, metadata string) error
+	// SendData sends a reliable data message on topic, to the given identities or to everybody when there are none
+	SendData(ctx context.Context, roomId, topic string, data []byte, identities []string) error
+	// RemoveParticipant disconnects a participant, it may join again with a valid token
+	RemoveParticipant(ctx context.Context, roomId, identity string) error
+	// ParticipantTracks lists the tracks a participant publishes
+	ParticipantTracks(ctx context.Context, roomId, identity string) ([]Track, error)
+	// MutePublishedTrack mutes or unmutes a track of a participant
+	MutePublishedTrack(ctx context.Context, roomId, identity, trackSid string, muted bool) error
+	// UpdateParticipantPermission applies the permissions of grant to a connected participant
+	UpdateParticipantPermission(ctx context.Context, roomId, identity string, grant *auth.VideoGrant) error
+	// StartRoomRecording records the composed room into a single file
+	StartRoomRecording(ctx context.Context, roomId string, output RecordingOutput) (*Egress, error)
+	// StopEgress stops a recording, the files are final once the egress_ended webhook arrives
+	StopEgress(ctx context.Context, egressId string) (*Egress, error)
+	// CreateIngress creates an RTMP or WHIP endpoint which publishes into the room as participant
+	CreateIngress(ctx context.Context, roomId, inputType string, participant IngressParticipant) (*Ingress, error)
+	// GetIngress returns an ingress with its current state
+	GetIngress(ctx context.Context, ingressId string) (*Ingress, error)
+	// DeleteIngress removes an ingress, its stream key stops working right away
+	DeleteIngress(ctx context.Context, ingressId string) error
+}
+
+// Track is a track published by a participant
+type Track struct {
+	Sid string `json:"sid"`
+	// Lower case LiveKit track source like "camera", "microphone" or "screen_share"
+	Source string `json:"source"`
+	Muted  bool   `json:"muted"`
+}
+
+// TwirpClient talks to the LiveKit server API, every call is signed with its own short lived token
+type TwirpClient struct {
+	apiKey    string
+	apiSecret string
+	rooms     livekit.RoomService
+	egress    livekit.Egress
+	ingress   livekit.Ingress
+}
+
+func NewTwirpClient(uri, apiKey, apiSecret string) *TwirpClient {
+	httpClient := &http.Client{Timeout: DefaultTimeout}
+	return &TwirpClient{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		rooms:     livekit.NewRoomServiceProtobufClient(uri, httpClient),
+		egress:    livekit.NewEgressProtobufClient(uri, httpClient),
+		ingress:   livekit.NewIngressProtobufClient(uri, httpClient),
+	}
+}
+
+func (l *TwirpClient) UpdateRoomMetadata(ctx context.Context, roomId, metadata string) error {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{RoomAdmin: true, Room: roomId})
+	if err != nil {
+		return err
+	}
+	_, err = l.rooms.UpdateRoomMetadata(ctx, &livekit.UpdateRoomMetadataRequest{
+		Room:     roomId,
+		Metadata: metadata,
+	})
+	return wrap("update room metadata", err)
+}
+
+func (l *TwirpClient) SendData(ctx context.Context, roomId, topic string, data []byte, identities []string) error {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{RoomAdmin: true, Room: roomId})
+	if err != nil {
+		return err
+	}
+	_, err = l.rooms.SendData(ctx, &livekit.SendDataRequest{
+		Room:                  roomId,
+		Data:                  data,
+		Kind:                  livekit.DataPacket_RELIABLE,
+		DestinationIdentities: identities,
+		Topic:                 &topic,
+	})
+	return wrap("send data", err)
+}
+
+func (l *TwirpClient) RemoveParticipant(ctx context.Context, roomId, identity string) error {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{RoomAdmin: true, Room: roomId})
+	if err != nil {
+		return err
+	}
+	_, err = l.rooms.RemoveParticipant(ctx, &livekit.RoomParticipantIdentity{
+		Room:     roomId,
+		Identity: identity,
+	})
+	return wrap("remove participant", err)
+}
+
+func (l *TwirpClient) ParticipantTracks(ctx context.Context, roomId, identity string) ([]Track, error) {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{RoomAdmin: true, Room: roomId})
+	if err != nil {
+		return nil, err
+	}
+	participant, err := l.rooms.GetParticipant(ctx, &livekit.RoomParticipantIdentity{
+		Room:     roomId,
+		Identity: identity,
+	})
+	if err != nil {
+		return nil, wrap("get participant", err)
+	}
+
+	tracks := make([]Track, 0, len(participant.GetTracks()))
+	for _, track := range participant.GetTracks() {
+		tracks = append(tracks, Track{
+			Sid:    track.GetSid(),
+			Source: strings.ToLower(track.GetSource().String()),
+			Muted:  track.GetMuted(),
+		})
+	}
+	return tracks, nil
+}
+
+func (l *TwirpClient) MutePublishedTrack(ctx context.Context, roomId, identity, trackSid string, muted bool) error {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{RoomAdmin: true, Room: roomId})
+	if err != nil {
+		return err
+	}
+	_, err = l.rooms.MutePublishedTrack(ctx, &livekit.MuteRoomTrackRequest{
+		Room:     roomId,
+		Identity: identity,
+		TrackSid: trackSid,
+		Muted:    muted,
+	})
+	return wrap("mute published track", err)
+}
+
+func (l *TwirpClient) UpdateParticipantPermission(ctx context.Context, roomId, identity string, grant *auth.VideoGrant) error {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{RoomAdmin: true, Room: roomId})
+	if err != nil {
+		return err
+	}
+	_, err = l.rooms.UpdateParticipant(ctx, &livekit.UpdateParticipantRequest{
+		Room:       roomId,
+		Identity:   identity,
+		Permission: grant.ToPermission(),
+	})
+	return wrap("update participant", err)
+}
+
+// authorize attaches a token carrying grant to the outgoing request
+func (l *TwirpClient) authorize(ctx context.Context, grant *auth.VideoGrant) (context.Context, error) {
+	token, err := auth.NewAccessToken(l.apiKey, l.apiSecret).
+		AddGrant(grant).
+		SetValidFor(callTokenTTL).
+		ToJWT()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign livekit api token: %w", err)
+	}
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer "+token)
+	return twirp.WithHTTPRequestHeaders(ctx, header)
+}
+
+// wrap names the failed call and maps the twirp errors callers distinguish
+func wrap(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var twirpErr twirp.Error
+	if errors.As(err, &twirpErr) && twirpErr.Code() == twirp.NotFound {
+		return fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
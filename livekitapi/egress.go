@@ -0,0 +1,137 @@
+package livekitapi
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+)
+
+// RecordingOutput tells egress where to write a recording
+type RecordingOutput struct {
+	// Path of the file, egress templates like {room_name} and {time} are expanded
+	Filepath string
+	// Room composite layout like "speaker" or "grid", empty for the egress default
+	Layout    string
+	AudioOnly bool
+	// Upload target, nil writes to the disk of the egress server
+	S3 *S3Output
+}
+
+// S3Output is an S3 compatible bucket recordings are uploaded to
+type S3Output struct {
+	AccessKey      string
+	Secret         string
+	Region         string
+	Endpoint       string
+	Bucket         string
+	ForcePathStyle bool
+}
+
+// Egress is the state of a recording as reported by LiveKit
+type Egress struct {
+	ID     string `json:"egressId"`
+	RoomID string `json:"roomId"`
+	// Lower case LiveKit egress status like "active" or "complete"
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	StartedAt *time.Time      `json:"startedAt,omitempty"`
+	EndedAt   *time.Time      `json:"endedAt,omitempty"`
+	Files     []RecordingFile `json:"files"`
+}
+
+// RecordingFile is a file written by egress, Location is its URL when it was uploaded
+type RecordingFile struct {
+	Filename string        `json:"filename"`
+	Location string        `json:"location,omitempty"`
+	Size     int64         `json:"size"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Finished reports whether egress stopped for good, successfully or not
+func (e *Egress) Finished() bool {
+	switch e.Status {
+	case "complete", "failed", "aborted", "limit_reached":
+		return true
+	}
+	return false
+}
+
+func (l *TwirpClient) StartRoomRecording(ctx context.Context, roomId string, output RecordingOutput) (*Egress, error) {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{RoomRecord: true})
+	if err != nil {
+		return nil, err
+	}
+
+	fileOutput := &livekit.EncodedFileOutput{
+		FileType: livekit.EncodedFileType_MP4,
+		Filepath: output.Filepath,
+	}
+	if output.AudioOnly {
+		fileOutput.FileType = livekit.EncodedFileType_OGG
+	}
+	if output.S3 != nil {
+		fileOutput.Output = &livekit.EncodedFileOutput_S3{S3: &livekit.S3Upload{
+			AccessKey:      output.S3.AccessKey,
+			Secret:         output.S3.Secret,
+			Region:         output.S3.Region,
+			Endpoint:       output.S3.Endpoint,
+			Bucket:         output.S3.Bucket,
+			ForcePathStyle: output.S3.ForcePathStyle,
+		}}
+	}
+
+	info, err := l.egress.StartRoomCompositeEgress(ctx, &livekit.RoomCompositeEgressRequest{
+		RoomName:    roomId,
+		Layout:      output.Layout,
+		AudioOnly:   output.AudioOnly,
+		FileOutputs: []*livekit.EncodedFileOutput{fileOutput},
+	})
+	if err != nil {
+		return nil, wrap("start room composite egress", err)
+	}
+	return EgressFromInfo(info), nil
+}
+
+func (l *TwirpClient) StopEgress(ctx context.Context, egressId string) (*Egress, error) {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{RoomRecord: true})
+	if err != nil {
+		return nil, err
+	}
+	info, err := l.egress.StopEgress(ctx, &livekit.StopEgressRequest{EgressId: egressId})
+	if err != nil {
+		return nil, wrap("stop egress", err)
+	}
+	return EgressFromInfo(info), nil
+}
+
+// EgressFromInfo converts the egress info of API responses and webhooks
+func EgressFromInfo(info *livekit.EgressInfo) *Egress {
+	egress := &Egress{
+		ID:     info.GetEgressId(),
+		RoomID: info.GetRoomName(),
+		Status: strings.ToLower(strings.TrimPrefix(info.GetStatus().String(), "EGRESS_")),
+		Error:  info.GetError(),
+		Files:  []RecordingFile{},
+	}
+	// Egress reports times in nanoseconds
+	if info.GetStartedAt() > 0 {
+		startedAt := time.Unix(0, info.GetStartedAt())
+		egress.StartedAt = &startedAt
+	}
+	if info.GetEndedAt() > 0 {
+		endedAt := time.Unix(0, info.GetEndedAt())
+		egress.EndedAt = &endedAt
+	}
+	for _, file := range info.GetFileResults() {
+		egress.Files = append(egress.Files, RecordingFile{
+			Filename: file.GetFilename(),
+			Location: file.GetLocation(),
+			Size:     file.GetSize(),
+			Duration: time.Duration(file.GetDuration()),
+		})
+	}
+	return egress
+}
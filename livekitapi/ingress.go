@@ -0,0 +1,115 @@
+package livekitapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/livekit"
+)
+
+// Ingress input types, the protocols an encoder like OBS pushes with
+const (
+	IngressRTMP = "rtmp"
+	IngressWHIP = "whip"
+)
+
+var ingressInputs = map[string]livekit.IngressInput{
+	IngressRTMP: livekit.IngressInput_RTMP_INPUT,
+	IngressWHIP: livekit.IngressInput_WHIP_INPUT,
+}
+
+// ValidIngressType reports whether an ingress of the type can be created
+func ValidIngressType(inputType string) bool {
+	_, ok := ingressInputs[inputType]
+	return ok
+}
+
+// IngressParticipant is who the ingress publishes as
+type IngressParticipant struct {
+	Identity string
+	Name     string
+	Metadata string
+}
+
+// Ingress is an endpoint an encoder publishes a room participant through
+type Ingress struct {
+	ID     string `json:"ingressId"`
+	RoomID string `json:"roomId"`
+	// IngressRTMP or IngressWHIP
+	Type string `json:"type"`
+	// URL and key the encoder is configured with, the key is a bearer token for WHIP
+	URL       string `json:"url"`
+	StreamKey string `json:"streamKey"`
+	// Lower case LiveKit ingress state like "inactive", "buffering" or "publishing"
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (l *TwirpClient) CreateIngress(ctx context.Context, roomId, inputType string, participant IngressParticipant) (*Ingress, error) {
+	input, ok := ingressInputs[inputType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported ingress type %q", inputType)
+	}
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{IngressAdmin: true})
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := l.ingress.CreateIngress(ctx, &livekit.CreateIngressRequest{
+		InputType:           input,
+		Name:                roomId,
+		RoomName:            roomId,
+		ParticipantIdentity: participant.Identity,
+		ParticipantName:     participant.Name,
+		ParticipantMetadata: participant.Metadata,
+	})
+	if err != nil {
+		return nil, wrap("create ingress", err)
+	}
+	return ingressFromInfo(info), nil
+}
+
+func (l *TwirpClient) GetIngress(ctx context.Context, ingressId string) (*Ingress, error) {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{IngressAdmin: true})
+	if err != nil {
+		return nil, err
+	}
+	res, err := l.ingress.ListIngress(ctx, &livekit.ListIngressRequest{IngressId: ingressId})
+	if err != nil {
+		return nil, wrap("list ingress", err)
+	}
+	for _, info := range res.GetItems() {
+		if info.GetIngressId() == ingressId {
+			return ingressFromInfo(info), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (l *TwirpClient) DeleteIngress(ctx context.Context, ingressId string) error {
+	ctx, err := l.authorize(ctx, &auth.VideoGrant{IngressAdmin: true})
+	if err != nil {
+		return err
+	}
+	_, err = l.ingress.DeleteIngress(ctx, &livekit.DeleteIngressRequest{IngressId: ingressId})
+	return wrap("delete ingress", err)
+}
+
+func ingressFromInfo(info *livekit.IngressInfo) *Ingress {
+	ingress := &Ingress{
+		ID:        info.GetIngressId(),
+		RoomID:    info.GetRoomName(),
+		URL:       info.GetUrl(),
+		StreamKey: info.GetStreamKey(),
+		Status:    strings.ToLower(strings.TrimPrefix(info.GetState().GetStatus().String(), "ENDPOINT_")),
+		Error:     info.GetState().GetError(),
+	}
+	for inputType, input := range ingressInputs {
+		if input == info.GetInputType() {
+			ingress.Type = inputType
+		}
+	}
+	return ingress
+}
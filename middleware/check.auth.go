@@ -17,6 +17,23 @@ type UserDetailsResponse struct {
 	Name         string `json:"name"`
 	Role         string `json:"role"`
 	TelegramName string `json:"telegramname"`
+	Verified     bool   `json:"verified"`
+}
+
+// Role given by the auth server to platform administrators
+const RoleAdmin = "admin"
+
+// Role given by the auth server to recording bot accounts
+const RoleRecorder = "recorder"
+
+// IsAdmin reports whether the user may manage rooms of other publishers
+func (u UserDetailsResponse) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsRecorder reports whether the user is a recording bot, which joins rooms hidden
+func (u UserDetailsResponse) IsRecorder() bool {
+	return u.Role == RoleRecorder
 }
 
 type APIResponse struct {
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// How long a request with the same Idempotency-Key may be running before another attempt is allowed
+const idempotencyLockTTL = 60 * time.Second
+
+// storedResponse is the response replayed for a repeated Idempotency-Key
+type storedResponse struct {
+	// SHA-256 of the request body, a key is only replayed for the same request
+	BodyHash    string `json:"bodyHash"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+// Idempotency replays the stored response of requests repeated with the same Idempotency-Key header.
+// It must run after CheckAuth, keys are scoped to the authenticated user.
+func Idempotency(client *redis.Client, ttl time.Duration) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" {
+			return c.Next()
+		}
+
+		user, ok := c.Locals("userDetails").(UserDetailsResponse)
+		if !ok {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Server error while retrieving user details"})
+		}
+		responseKey := "idempotency:" + user.ID + ":" + c.Path() + ":" + key
+		lockKey := responseKey + ":lock"
+		sum := sha256.Sum256(c.Body())
+		bodyHash := hex.EncodeToString(sum[:])
+
+		if stored, err := client.Get(c.Context(), responseKey).Bytes(); err == nil {
+			var response storedResponse
+			if err := json.Unmarshal(stored, &response); err == nil {
+				if response.BodyHash != bodyHash {
+					return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+						"status":  "error",
+						"message": "Idempotency-Key was already used with a different request body",
+					})
+				}
+				c.Set("Idempotent-Replayed", "true")
+				c.Set(fiber.HeaderContentType, response.ContentType)
+				return c.Status(response.Status).Send(response.Body)
+			}
+		}
+
+		locked, err := client.SetNX(c.Context(), lockKey, 1, idempotencyLockTTL).Result()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error checking Idempotency-Key"})
+		}
+		if !locked {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":  "error",
+				"message": "A request with this Idempotency-Key is still in progress",
+			})
+		}
+		defer client.Del(c.Context(), lockKey)
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		// Server errors are not stored, the client should be able to retry them
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusInternalServerError {
+			return nil
+		}
+		response, err := json.Marshal(storedResponse{
+			BodyHash:    bodyHash,
+			Status:      status,
+			ContentType: string(c.Response().Header.ContentType()),
+			Body:        c.Response().Body(),
+		})
+		if err == nil {
+			client.Set(c.Context(), responseKey, response, ttl)
+		}
+		return nil
+	}
+}
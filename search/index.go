@@ -0,0 +1,151 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fields of a room that can be searched, matches on earlier fields rank higher
+const (
+	FieldTitle     = "title"
+	FieldPublisher = "publisher"
+	FieldProduct   = "product"
+)
+
+var fieldWeights = map[string]float64{
+	FieldTitle:     3,
+	FieldPublisher: 2,
+	FieldProduct:   1,
+}
+
+// Document is the searchable content of a room
+type Document struct {
+	Title     string
+	Publisher string
+	Products  []string
+}
+
+// Result is a room matching a query with its rank
+type Result struct {
+	RoomID string  `json:"roomId"`
+	Score  float64 `json:"score"`
+}
+
+// Index keeps the searchable content of active rooms
+type Index interface {
+	Put(ctx context.Context, roomId string, doc Document) error
+	Remove(ctx context.Context, roomId string) error
+	Search(ctx context.Context, query string, limit int) ([]Result, error)
+}
+
+// posting is a single token of a room document
+type posting struct {
+	Token  string
+	Field  string
+	RoomID string
+}
+
+// Normalize lowercases the text and strips diacritics, so "Café" and "cafe" are equal
+func Normalize(text string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	normalized, _, err := transform.String(t, text)
+	if err != nil {
+		normalized = text
+	}
+	return strings.ToLower(normalized)
+}
+
+// Tokenize splits normalized text into words
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(Normalize(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// postings returns the distinct tokens of a document per field
+func postings(roomId string, doc Document) []posting {
+	seen := make(map[posting]bool)
+	var out []posting
+	add := func(field, text string) {
+		for _, token := range Tokenize(text) {
+			p := posting{Token: token, Field: field, RoomID: roomId}
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+
+	add(FieldTitle, doc.Title)
+	add(FieldPublisher, doc.Publisher)
+	for _, product := range doc.Products {
+		add(FieldProduct, product)
+	}
+	return out
+}
+
+// scorer ranks rooms which match every token of a query
+type scorer struct {
+	terms  []string
+	scores []map[string]float64
+}
+
+func newScorer(query string) *scorer {
+	terms := Tokenize(query)
+	scores := make([]map[string]float64, len(terms))
+	for i := range scores {
+		scores[i] = make(map[string]float64)
+	}
+	return &scorer{terms: terms, scores: scores}
+}
+
+// add records a posting found for the i-th query term, exact token matches weigh twice a prefix match
+func (s *scorer) add(i int, p posting) {
+	score := fieldWeights[p.Field]
+	if p.Token == s.terms[i] {
+		score *= 2
+	}
+	if score > s.scores[i][p.RoomID] {
+		s.scores[i][p.RoomID] = score
+	}
+}
+
+func (s *scorer) results(limit int) []Result {
+	if len(s.terms) == 0 {
+		return []Result{}
+	}
+
+	results := []Result{}
+	for roomId, score := range s.scores[0] {
+		total := score
+		matchesAll := true
+		for _, termScores := range s.scores[1:] {
+			termScore, ok := termScores[roomId]
+			if !ok {
+				matchesAll = false
+				break
+			}
+			total += termScore
+		}
+		if matchesAll {
+			results = append(results, Result{RoomID: roomId, Score: total})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].RoomID < results[j].RoomID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,34 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", []string{}},
+		{"lowercases", "Gold SIGNALS", []string{"gold", "signals"}},
+		{"strips diacritics", "Café Crème", []string{"cafe", "creme"}},
+		{"splits on punctuation", "BTC/USDT: long-term!", []string{"btc", "usdt", "long", "term"}},
+		{"keeps digits", "Top 10 picks 2024", []string{"top", "10", "picks", "2024"}},
+		{"keeps non latin letters", "Торговля Акциями", []string{"торговля", "акциями"}},
+		{"only separators", " - / ! ", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Tokenize(tt.text)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// MemoryIndex keeps the index in process memory, for tests and single instance development
+type MemoryIndex struct {
+	mu    sync.RWMutex
+	rooms map[string][]posting
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{rooms: make(map[string][]posting)}
+}
+
+func (idx *MemoryIndex) Put(ctx context.Context, roomId string, doc Document) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.rooms[roomId] = postings(roomId, doc)
+	return nil
+}
+
+func (idx *MemoryIndex) Remove(ctx context.Context, roomId string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	delete(idx.rooms, roomId)
+	return nil
+}
+
+func (idx *MemoryIndex) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	s := newScorer(query)
+	for i, term := range s.terms {
+		for _, roomPostings := range idx.rooms {
+			for _, p := range roomPostings {
+				if strings.HasPrefix(p.Token, term) {
+					s.add(i, p)
+				}
+			}
+		}
+	}
+	return s.results(limit), nil
+}
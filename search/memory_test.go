@@ -0,0 +1,74 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryIndexSearch(t *testing.T) {
+	ctx := context.Background()
+	idx := NewMemoryIndex()
+	docs := map[string]Document{
+		"gold":   {Title: "Gold trading live", Publisher: "Anna", Products: []string{"Gold course"}},
+		"crypto": {Title: "Crypto morning", Publisher: "Goldman", Products: []string{"BTC signals"}},
+		"forex":  {Title: "Forex basics", Publisher: "Ben", Products: []string{"Golden ebook", "EUR/USD guide"}},
+	}
+	for roomId, doc := range docs {
+		if err := idx.Put(ctx, roomId, doc); err != nil {
+			t.Fatalf("Put(%s): %v", roomId, err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		// Title over publisher over product, exact matches over prefixes
+		{"ranks by field and exactness", "gold", 0, []string{"gold", "crypto", "forex"}},
+		{"matches prefixes", "cryp", 0, []string{"crypto"}},
+		{"requires every term", "gold ebook", 0, []string{"forex"}},
+		{"ignores case and diacritics", "GÖLD", 0, []string{"gold", "crypto", "forex"}},
+		{"applies the limit", "gold", 1, []string{"gold"}},
+		{"no match", "stocks", 0, []string{}},
+		{"empty query", "", 0, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := idx.Search(ctx, tt.query, tt.limit)
+			if err != nil {
+				t.Fatalf("Search(%q): %v", tt.query, err)
+			}
+			got := []string{}
+			for _, result := range results {
+				got = append(got, result.RoomID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryIndexPutAndRemove(t *testing.T) {
+	ctx := context.Background()
+	idx := NewMemoryIndex()
+
+	idx.Put(ctx, "room", Document{Title: "Old title"})
+	// Put replaces the whole document of a room
+	idx.Put(ctx, "room", Document{Title: "New title"})
+	if results, _ := idx.Search(ctx, "old", 0); len(results) != 0 {
+		t.Errorf("Search(old) after replacing the document = %v, want none", results)
+	}
+	if results, _ := idx.Search(ctx, "new", 0); len(results) != 1 {
+		t.Errorf("Search(new) = %v, want the room", results)
+	}
+
+	idx.Remove(ctx, "room")
+	if results, _ := idx.Search(ctx, "new", 0); len(results) != 0 {
+		t.Errorf("Search(new) after Remove = %v, want none", results)
+	}
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Sorted set with score 0 holding "<token>\x00<field>\x00<roomId>" members for lexicographic prefix ranges
+	tokensKey = "search:tokens"
+	// Set of the members a room added to tokensKey, used to remove them again
+	roomTokensPrefix = "search:room:"
+	// Upper bound of postings read for a single query term
+	maxPostingsPerTerm = 1000
+)
+
+// RedisIndex stores the index in Redis so that every replica sees the same rooms
+type RedisIndex struct {
+	client *redis.Client
+}
+
+func NewRedisIndex(client *redis.Client) *RedisIndex {
+	return &RedisIndex{client: client}
+}
+
+func encodePosting(p posting) string {
+	return p.Token + "\x00" + p.Field + "\x00" + p.RoomID
+}
+
+func decodePosting(member string) (posting, bool) {
+	parts := strings.SplitN(member, "\x00", 3)
+	if len(parts) != 3 {
+		return posting{}, false
+	}
+	return posting{Token: parts[0], Field: parts[1], RoomID: parts[2]}, true
+}
+
+func (idx *RedisIndex) Put(ctx context.Context, roomId string, doc Document) error {
+	if err := idx.Remove(ctx, roomId); err != nil {
+		return err
+	}
+
+	members := []interface{}{}
+	entries := []redis.Z{}
+	for _, p := range postings(roomId, doc) {
+		member := encodePosting(p)
+		members = append(members, member)
+		entries = append(entries, redis.Z{Score: 0, Member: member})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	_, err := idx.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, tokensKey, entries...)
+		pipe.SAdd(ctx, roomTokensPrefix+roomId, members...)
+		return nil
+	})
+	return err
+}
+
+func (idx *RedisIndex) Remove(ctx context.Context, roomId string) error {
+	members, err := idx.client.SMembers(ctx, roomTokensPrefix+roomId).Result()
+	if err != nil {
+		return err
+	}
+
+	_, err = idx.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(members) > 0 {
+			values := make([]interface{}, len(members))
+			for i, member := range members {
+				values[i] = member
+			}
+			pipe.ZRem(ctx, tokensKey, values...)
+		}
+		pipe.Del(ctx, roomTokensPrefix+roomId)
+		return nil
+	})
+	return err
+}
+
+func (idx *RedisIndex) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	s := newScorer(query)
+	for i, term := range s.terms {
+		// Every member starting with the term, "\xff" sorts after any UTF-8 byte
+		members, err := idx.client.ZRangeByLex(ctx, tokensKey, &redis.ZRangeBy{
+			Min:   "[" + term,
+			Max:   "[" + term + "\xff",
+			Count: maxPostingsPerTerm,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			if p, ok := decodePosting(member); ok {
+				s.add(i, p)
+			}
+		}
+	}
+	return s.results(limit), nil
+}
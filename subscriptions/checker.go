@@ -0,0 +1,36 @@
+package subscriptions
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrDisabled is returned by Disabled, subscriber-only chat needs a subscription source
+var ErrDisabled = errors.New("no subscription source is configured")
+
+// Checker tells whether a user subscribed to a publisher. Implementations may call out
+// to the platform, an error means the subscription could not be checked.
+type Checker interface {
+	IsSubscriber(ctx context.Context, publisherId, userId string) (bool, error)
+}
+
+// Func adapts a function to Checker, handy for in-process fakes
+type Func func(ctx context.Context, publisherId, userId string) (bool, error)
+
+func (f Func) IsSubscriber(ctx context.Context, publisherId, userId string) (bool, error) {
+	return f(ctx, publisherId, userId)
+}
+
+// Disabled is the checker of deployments without chat.subscriptions_uri
+type Disabled struct{}
+
+func (Disabled) IsSubscriber(ctx context.Context, publisherId, userId string) (bool, error) {
+	return false, ErrDisabled
+}
+
+// Available reports whether the checker can answer at all, rooms can't turn on
+// subscriber-only chat otherwise
+func Available(checker Checker) bool {
+	_, disabled := checker.(Disabled)
+	return checker != nil && !disabled
+}
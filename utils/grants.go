@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"fmt"
+	"streaming/initializers"
+
+	"github.com/livekit/protocol/auth"
+)
+
+// Room roles, each one is mapped to a grant profile
+const (
+	RolePublisher   = "publisher"
+	RoleCoHost      = "co-host"
+	RoleModerator   = "moderator"
+	RoleViewer      = "viewer"
+	RoleMutedViewer = "muted-viewer"
+	RoleRecorder    = "recorder"
+)
+
+// Built-in profiles, any profile defined in config.yaml replaces the one with the same name.
+// The publisher moderates through the server endpoints, which audit it, not with RoomAdmin.
+var defaultGrantProfiles = map[string]initializers.GrantProfile{
+	RolePublisher: {
+		CanPublish:           true,
+		CanSubscribe:         true,
+		CanPublishData:       true,
+		CanUpdateOwnMetadata: true,
+	},
+	RoleCoHost: {
+		CanPublish:        true,
+		CanSubscribe:      true,
+		CanPublishData:    true,
+		CanPublishSources: []string{"camera", "microphone", "screen_share"},
+	},
+	RoleModerator: {
+		CanSubscribe:   true,
+		CanPublishData: true,
+		RoomAdmin:      true,
+	},
+	RoleViewer: {
+		CanSubscribe:   true,
+		CanPublishData: true,
+	},
+	// Watches without sending anything, not even data messages
+	RoleMutedViewer: {
+		CanSubscribe: true,
+	},
+	// Recording bots stay out of the participant list
+	RoleRecorder: {
+		CanSubscribe: true,
+		Hidden:       true,
+	},
+}
+
+// GetGrantProfile returns the grant profile configured for a room role
+func GetGrantProfile(role string, config *initializers.Config) (initializers.GrantProfile, error) {
+	if profile, ok := config.LiveKit.GrantProfiles[role]; ok {
+		return profile, nil
+	}
+	if profile, ok := defaultGrantProfiles[role]; ok {
+		return profile, nil
+	}
+	return initializers.GrantProfile{}, fmt.Errorf("unknown room role %q", role)
+}
+
+// NewVideoGrant builds the LiveKit grant of a room role
+func NewVideoGrant(role, roomId string, config *initializers.Config) (*auth.VideoGrant, error) {
+	profile, err := GetGrantProfile(role, config)
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &auth.VideoGrant{
+		RoomJoin:  true,
+		Room:      roomId,
+		RoomAdmin: profile.RoomAdmin,
+		Hidden:    profile.Hidden,
+		Recorder:  role == RoleRecorder,
+	}
+	grant.SetCanPublish(profile.CanPublish)
+	grant.SetCanSubscribe(profile.CanSubscribe)
+	grant.SetCanPublishData(profile.CanPublishData)
+	grant.SetCanUpdateOwnMetadata(profile.CanUpdateOwnMetadata)
+	if len(profile.CanPublishSources) > 0 {
+		grant.CanPublishSources = profile.CanPublishSources
+	}
+	return grant, nil
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"streaming/initializers"
+	"testing"
+
+	"github.com/livekit/protocol/auth"
+)
+
+func TestCreateTokenGrants(t *testing.T) {
+	tests := []struct {
+		role            string
+		wantPublish     bool
+		wantSubscribe   bool
+		wantData        bool
+		wantHidden      bool
+		wantRecorder    bool
+		wantRoomAdmin   bool
+		wantOwnMetadata bool
+	}{
+		{role: RolePublisher, wantPublish: true, wantSubscribe: true, wantData: true, wantOwnMetadata: true},
+		{role: RoleCoHost, wantPublish: true, wantSubscribe: true, wantData: true},
+		{role: RoleModerator, wantSubscribe: true, wantData: true, wantRoomAdmin: true},
+		{role: RoleViewer, wantSubscribe: true, wantData: true},
+		{role: RoleMutedViewer, wantSubscribe: true},
+		{role: RoleRecorder, wantSubscribe: true, wantHidden: true, wantRecorder: true},
+	}
+
+	config := &initializers.Config{
+		LiveKit: initializers.LiveKitConfig{APIKey: "key", APISecret: "a-secret-of-at-least-32-characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			token, err := CreateToken(tt.role, "room", "user", "Anna", ParticipantMetadata{}, config)
+			if err != nil {
+				t.Fatalf("CreateToken() = %v", err)
+			}
+			verifier, err := auth.ParseAPIToken(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := verifier.Verify(config.LiveKit.APISecret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			grant := claims.Video
+
+			if grant.Room != "room" || !grant.RoomJoin {
+				t.Errorf("joins %q %t, want room true", grant.Room, grant.RoomJoin)
+			}
+			if got := grant.GetCanPublish(); got != tt.wantPublish {
+				t.Errorf("can publish = %t, want %t", got, tt.wantPublish)
+			}
+			if got := grant.GetCanSubscribe(); got != tt.wantSubscribe {
+				t.Errorf("can subscribe = %t, want %t", got, tt.wantSubscribe)
+			}
+			if got := grant.GetCanPublishData(); got != tt.wantData {
+				t.Errorf("can publish data = %t, want %t", got, tt.wantData)
+			}
+			if grant.Hidden != tt.wantHidden {
+				t.Errorf("hidden = %t, want %t", grant.Hidden, tt.wantHidden)
+			}
+			if grant.Recorder != tt.wantRecorder {
+				t.Errorf("recorder = %t, want %t", grant.Recorder, tt.wantRecorder)
+			}
+			if grant.RoomAdmin != tt.wantRoomAdmin {
+				t.Errorf("room admin = %t, want %t", grant.RoomAdmin, tt.wantRoomAdmin)
+			}
+			if got := grant.GetCanUpdateOwnMetadata(); got != tt.wantOwnMetadata {
+				t.Errorf("can update own metadata = %t, want %t", got, tt.wantOwnMetadata)
+			}
+		})
+	}
+}
+
+func TestGrantProfileFromConfig(t *testing.T) {
+	config := &initializers.Config{
+		LiveKit: initializers.LiveKitConfig{GrantProfiles: map[string]initializers.GrantProfile{
+			RoleMutedViewer: {CanSubscribe: true, CanPublishData: true},
+		}},
+	}
+	profile, err := GetGrantProfile(RoleMutedViewer, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !profile.CanPublishData {
+		t.Errorf("configured profile was not used: %+v", profile)
+	}
+	if _, err := GetGrantProfile("unknown", config); err == nil {
+		t.Error("unknown role was accepted")
+	}
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Prefix of generated guest identities
+const guestIdentityPrefix = "guest-"
+
+// IsGuestIdentity reports whether the identity was generated for a guest by NewGuestIdentity
+func IsGuestIdentity(identity string) bool {
+	return strings.HasPrefix(identity, guestIdentityPrefix)
+}
+
+// NewGuestIdentity generates a random "guest-<hex>" identity and the display name shown for it
+func NewGuestIdentity() (identity string, name string, err error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	suffix := hex.EncodeToString(buf)
+
+	// Guests are always displayed as "Guest XXXX", they can't pick a name
+	return guestIdentityPrefix + suffix, "Guest " + strings.ToUpper(suffix[:4]), nil
+}
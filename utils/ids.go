@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"crypto/rand"
+
+	"github.com/google/uuid"
+)
+
+// Slug alphabet without look-alike characters (0/o, 1/l/i)
+const slugAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+const SlugLength = 8
+
+// NewRoomID generates an unguessable, time ordered room ID
+func NewRoomID() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// NewSlug generates a short human friendly ID for share links
+func NewSlug() (string, error) {
+	buf := make([]byte, SlugLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	slug := make([]byte, SlugLength)
+	for i, b := range buf {
+		slug[i] = slugAlphabet[int(b)%len(slugAlphabet)]
+	}
+	return string(slug), nil
+}
@@ -1 +1,71 @@
 package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Page size limits for listing endpoints
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at the last item of a page in a sorted set, the next page starts after it
+type Cursor struct {
+	Score  float64
+	Member string
+}
+
+// Encode turns the cursor into an opaque string safe for query params
+func (c Cursor) Encode() string {
+	raw := strconv.FormatFloat(c.Score, 'f', -1, 64) + "|" + c.Member
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// After reports whether an item in a descending listing comes after the cursor
+func (c Cursor) After(score float64, member string) bool {
+	return score < c.Score || (score == c.Score && member < c.Member)
+}
+
+// AfterAscending reports whether an item in an ascending listing comes after the cursor
+func (c Cursor) AfterAscending(score float64, member string) bool {
+	return score > c.Score || (score == c.Score && member > c.Member)
+}
+
+// DecodeCursor parses a cursor produced by Encode, an empty string means the first page
+func DecodeCursor(value string) (*Cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	score, member, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+	parsed, err := strconv.ParseFloat(score, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{Score: parsed, Member: member}, nil
+}
+
+// ParseLimit reads a page size from a query param, falling back to the default and capping it
+func ParseLimit(value string) int {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return limit
+}
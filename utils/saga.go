@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SagaStep is one side effect of a multi-step operation and the action that reverts it
+type SagaStep struct {
+	Name string
+	Do   func(ctx context.Context) error
+	// Undo may be nil for steps that have nothing to revert
+	Undo func(ctx context.Context) error
+	// UndoFailed runs Undo for this step as well when Do fails, for side effects which may
+	// have happened before the failure was noticed, like a request that timed out
+	UndoFailed bool
+}
+
+// SagaError reports the step that failed and any compensation that failed as well
+type SagaError struct {
+	Step       string
+	Err        error
+	UndoErrors []error
+}
+
+func (e *SagaError) Error() string {
+	if len(e.UndoErrors) > 0 {
+		return fmt.Sprintf("%s failed: %v (rollback failed: %v)", e.Step, e.Err, errors.Join(e.UndoErrors...))
+	}
+	return fmt.Sprintf("%s failed: %v", e.Step, e.Err)
+}
+
+func (e *SagaError) Unwrap() error {
+	return e.Err
+}
+
+// RunSaga executes the steps in order, when one fails the completed ones are undone in reverse order
+func RunSaga(ctx context.Context, steps []SagaStep) error {
+	for i, step := range steps {
+		err := step.Do(ctx)
+		if err == nil {
+			continue
+		}
+
+		sagaErr := &SagaError{Step: step.Name, Err: err}
+		first := i - 1
+		if step.UndoFailed {
+			first = i
+		}
+		for j := first; j >= 0; j-- {
+			if steps[j].Undo == nil {
+				continue
+			}
+			if undoErr := steps[j].Undo(ctx); undoErr != nil {
+				sagaErr.UndoErrors = append(sagaErr.UndoErrors, fmt.Errorf("%s: %w", steps[j].Name, undoErr))
+			}
+		}
+		return sagaErr
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordingSteps returns steps which log their calls, the step named failAt fails
+func recordingSteps(names []string, failAt string, calls *[]string) []SagaStep {
+	steps := make([]SagaStep, len(names))
+	for i, name := range names {
+		name := name
+		steps[i] = SagaStep{
+			Name: name,
+			Do: func(ctx context.Context) error {
+				*calls = append(*calls, "do "+name)
+				if name == failAt {
+					return errors.New(name + " broke")
+				}
+				return nil
+			},
+			Undo: func(ctx context.Context) error {
+				*calls = append(*calls, "undo "+name)
+				return nil
+			},
+		}
+	}
+	return steps
+}
+
+func TestRunSaga(t *testing.T) {
+	names := []string{"a", "b", "c", "d"}
+	tests := []struct {
+		failAt string
+		want   []string
+	}{
+		{"", []string{"do a", "do b", "do c", "do d"}},
+		{"a", []string{"do a"}},
+		{"b", []string{"do a", "do b", "undo a"}},
+		{"c", []string{"do a", "do b", "do c", "undo b", "undo a"}},
+		{"d", []string{"do a", "do b", "do c", "do d", "undo c", "undo b", "undo a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("fail at "+tt.failAt, func(t *testing.T) {
+			var calls []string
+			err := RunSaga(context.Background(), recordingSteps(names, tt.failAt, &calls))
+
+			if !reflect.DeepEqual(calls, tt.want) {
+				t.Errorf("calls = %q, want %q", calls, tt.want)
+			}
+			if tt.failAt == "" {
+				if err != nil {
+					t.Errorf("RunSaga() = %v, want nil", err)
+				}
+				return
+			}
+			var sagaErr *SagaError
+			if !errors.As(err, &sagaErr) || sagaErr.Step != tt.failAt {
+				t.Fatalf("RunSaga() = %v, want a SagaError of step %s", err, tt.failAt)
+			}
+			if len(sagaErr.UndoErrors) != 0 {
+				t.Errorf("UndoErrors = %v, want none", sagaErr.UndoErrors)
+			}
+		})
+	}
+}
+
+func TestRunSagaUndoFailures(t *testing.T) {
+	errStep := errors.New("step broke")
+	var calls []string
+	steps := []SagaStep{
+		{
+			Name: "first",
+			Do:   func(ctx context.Context) error { return nil },
+			Undo: func(ctx context.Context) error {
+				calls = append(calls, "undo first")
+				return errors.New("first can't be undone")
+			},
+		},
+		// Nothing to revert, skipped during the rollback
+		{Name: "second", Do: func(ctx context.Context) error { return nil }},
+		{
+			Name: "third",
+			Do:   func(ctx context.Context) error { return nil },
+			Undo: func(ctx context.Context) error {
+				calls = append(calls, "undo third")
+				return nil
+			},
+		},
+		{Name: "fourth", Do: func(ctx context.Context) error { return errStep }},
+	}
+
+	err := RunSaga(context.Background(), steps)
+
+	// A failing compensation does not stop the ones before it
+	if want := []string{"undo third", "undo first"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	if !errors.Is(err, errStep) {
+		t.Errorf("RunSaga() = %v, want it to wrap the step error", err)
+	}
+	var sagaErr *SagaError
+	if !errors.As(err, &sagaErr) || len(sagaErr.UndoErrors) != 1 {
+		t.Fatalf("RunSaga() = %v, want one undo error", err)
+	}
+}
+
+func TestRunSagaUndoFailed(t *testing.T) {
+	var calls []string
+	steps := recordingSteps([]string{"a", "b", "c"}, "b", &calls)
+	// b may have taken effect before it failed
+	steps[1].UndoFailed = true
+
+	err := RunSaga(context.Background(), steps)
+
+	if want := []string{"do a", "do b", "undo b", "undo a"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	var sagaErr *SagaError
+	if !errors.As(err, &sagaErr) || sagaErr.Step != "b" {
+		t.Fatalf("RunSaga() = %v, want a SagaError of step b", err)
+	}
+}
@@ -1,31 +1,149 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"streaming/initializers"
 	"time"
 
 	"github.com/livekit/protocol/auth"
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
-func CreateToken(isStreamer bool, roomId, userId, userName, userAvatar string, config *initializers.Config) (string, error) {
+// Token lifetime used when neither the role nor "default" is configured
+const defaultTokenTTL = 6 * time.Hour
+
+// Co-host tokens keep publish rights after the co-host is removed, so they don't fall back to
+// "default" and are refreshed often, every refresh re-derives the role from the room
+const defaultCoHostTokenTTL = 15 * time.Minute
+
+// Participant metadata formats, version 1 is the bare avatar URL older clients expect
+const (
+	MetadataV1 = 1
+	MetadataV2 = 2
+)
+
+// ParticipantMetadata is what clients need to render a participant without asking the backend
+type ParticipantMetadata struct {
+	Version      int    `json:"v"`
+	Avatar       string `json:"avatar"`
+	Role         string `json:"role,omitempty"`
+	TelegramName string `json:"telegramName,omitempty"`
+	Verified     bool   `json:"verified"`
+	RoomRole     string `json:"roomRole"`
+}
+
+// Encode renders the metadata in the requested version
+func (m ParticipantMetadata) Encode() (string, error) {
+	switch m.Version {
+	case 0, MetadataV1:
+		return m.Avatar, nil
+	case MetadataV2:
+		data, err := json.Marshal(m)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	default:
+		return "", fmt.Errorf("unsupported metadata version %d", m.Version)
+	}
+}
+
+// TokenTTL returns how long a token of the room role stays valid, see LiveKitConfig.ParseTokenLifetimes
+func TokenTTL(role string, config *initializers.Config) time.Duration {
+	if role == RoleCoHost {
+		if ttl, ok := config.LiveKit.RoleTokenLifetime(role); ok {
+			return ttl
+		}
+		return defaultCoHostTokenTTL
+	}
+	if ttl, ok := config.LiveKit.TokenLifetime(role); ok {
+		return ttl
+	}
+	return defaultTokenTTL
+}
+
+func CreateToken(role, roomId, userId, userName string, metadata ParticipantMetadata, config *initializers.Config) (string, error) {
 
 	LiveKitAPISecret := config.LiveKit.APISecret
 	LiveKitAPIKey := config.LiveKit.APIKey
-	trueVal := true
 
-	at := auth.NewAccessToken(LiveKitAPIKey, LiveKitAPISecret)
-	grant := &auth.VideoGrant{
-		RoomJoin:       true,
-		Room:           roomId,
-		CanPublish:     &isStreamer,
-		CanPublishData: &trueVal,
+	grant, err := NewVideoGrant(role, roomId, config)
+	if err != nil {
+		return "", err
 	}
+
+	ttl := TokenTTL(role, config)
+
+	metadata.RoomRole = role
+	encodedMetadata, err := metadata.Encode()
+	if err != nil {
+		return "", err
+	}
+
+	at := auth.NewAccessToken(LiveKitAPIKey, LiveKitAPISecret)
 	at.AddGrant(grant).
 		SetIdentity(userId).
-		SetValidFor(6 * time.Hour).
-		SetMetadata(userAvatar).
+		SetValidFor(ttl).
+		SetMetadata(encodedMetadata).
 		SetName(userName)
 
 	return at.ToJWT()
 
 }
+
+// Refresh window used when livekit.refresh_window is not configured
+const defaultRefreshWindow = 10 * time.Minute
+
+// ErrInvalidToken is returned for tokens we did not issue or which belong to somebody else
+var ErrInvalidToken = errors.New("invalid token")
+
+// RefreshWindow returns how long before expiry a token may be re-issued
+func RefreshWindow(config *initializers.Config) time.Duration {
+	if window := config.LiveKit.RefreshWindowDuration(); window > 0 {
+		return window
+	}
+	return defaultRefreshWindow
+}
+
+// How long after expiry a token may still be refreshed, covers clock skew and a client which was briefly offline
+const refreshGrace = time.Minute
+
+// ErrTokenExpired is returned for tokens past their expiry, the client has to join again
+var ErrTokenExpired = errors.New("token expired")
+
+// CheckRefresh verifies a token issued to identity and reports the room it is for and whether it is
+// inside the refresh window. The refreshed token is built from the current room state by the caller,
+// never from the grants of the old one.
+func CheckRefresh(token, identity string, config *initializers.Config) (roomId string, expiresAt time.Time, due bool, err error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return "", time.Time{}, false, ErrInvalidToken
+	}
+
+	claims := jwt.Claims{}
+	grants := auth.ClaimGrants{}
+	if err := parsed.Claims([]byte(config.LiveKit.APISecret), &claims, &grants); err != nil {
+		return "", time.Time{}, false, ErrInvalidToken
+	}
+
+	if grants.Video == nil || grants.Video.Room == "" || claims.Expiry == nil {
+		return "", time.Time{}, false, ErrInvalidToken
+	}
+	// The issuer is the API key the token was signed for and the subject its identity
+	err = claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:  config.LiveKit.APIKey,
+		Subject: identity,
+		Time:    time.Now(),
+	}, refreshGrace)
+	if errors.Is(err, jwt.ErrExpired) {
+		return "", time.Time{}, false, ErrTokenExpired
+	} else if err != nil {
+		return "", time.Time{}, false, ErrInvalidToken
+	}
+
+	expiresAt = claims.Expiry.Time()
+	due = !time.Now().Before(expiresAt.Add(-RefreshWindow(config)))
+	return grants.Video.Room, expiresAt, due, nil
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"streaming/initializers"
+	"testing"
+	"time"
+)
+
+func TestTokenTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		tokenTTL map[string]string
+		role     string
+		want     time.Duration
+	}{
+		{"unconfigured viewer", nil, RoleViewer, defaultTokenTTL},
+		{"viewer falls back to default", map[string]string{"default": "2h"}, RoleViewer, 2 * time.Hour},
+		{"role overrides default", map[string]string{"default": "2h", RoleViewer: "30m"}, RoleViewer, 30 * time.Minute},
+		{"unconfigured co-host", nil, RoleCoHost, defaultCoHostTokenTTL},
+		{"co-host ignores default", map[string]string{"default": "2h"}, RoleCoHost, defaultCoHostTokenTTL},
+		{"configured co-host", map[string]string{"default": "2h", RoleCoHost: "5m"}, RoleCoHost, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &initializers.Config{}
+			config.LiveKit.TokenTTL = tt.tokenTTL
+			if err := config.LiveKit.ParseTokenLifetimes(); err != nil {
+				t.Fatal(err)
+			}
+			if got := TokenTTL(tt.role, config); got != tt.want {
+				t.Errorf("TokenTTL(%q) = %s, want %s", tt.role, got, tt.want)
+			}
+		})
+	}
+}